@@ -1,104 +1,195 @@
 // This file is used to initialize and run the main program.
+// The membership daemon itself lives in the membership package.
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
+
+	"github.com/hangary/cs425_mp/membership"
 )
 
 // entry point
 func main() {
-	initialize()
+	config := initialize()
+	node := membership.NewNode(config)
 	// run the daemon
-	DaemonRun()
-	// Exit
-	os.Exit(0)
+	if err := node.Start(context.Background()); err != nil {
+		membership.ErrorLogger.Println(err)
+		os.Exit(1)
+	}
+	defer node.Close()
+	// check initialization
+	membership.DebugLogger.Println("Check initialization:", node.Addr(), node.ID(), node.Members())
+
+	// continuously, handle commands from user until interrupted
+	command := make(chan membership.Command)
+	go readCommand(command)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	for {
+		select {
+		case c := <-command:
+			if err := node.HandleCommand(c); err != nil {
+				membership.WarnLogger.Println(err)
+			}
+		case <-interrupt:
+			return
+		}
+	}
 }
 
-// initialize
-func initialize()  {
+// initialize the config from flags, and from the config file for flags not given
+func initialize() membership.Config {
 	// parse flags
-	var localhost, localport string
+	var config membership.Config
+	var configFile, localhost, localport string
+	var debugMode, gossipMode bool
+	var detector, codec, key, keyFile, meta, seeds string
+	var phiThreshold float64
+	flag.StringVar(&configFile, "config", "", "JSON file of flag values, e.g. {\"port\": \"2333\", \"gossip-timeout\": \"10s\"}, flags given override it")
 	flag.StringVar(&localhost, "host", "localhost", "the local host")
 	flag.StringVar(&localport, "port", "2333", "the local port")
-	flag.BoolVar(&VMMode, "vm", false, "whether run in the vm")
-	flag.BoolVar(&IntroducerMode, "introducer", false, "whether is the introducer server")
-	flag.BoolVar(&DebugMode, "debug", false, "whether is in debug mode")
-	flag.BoolVar(&GossipMode, "gossip", false, "whether is in gossip mode")
-	flag.Float64Var(&MessageLossRate, "experiment", 0, "whether simulate message loss")
+	flag.BoolVar(&config.VMMode, "vm", false, "whether run in the vm")
+	flag.BoolVar(&config.Introducer, "introducer", false, "deprecated, has no effect: any running member is a seed")
+	flag.BoolVar(&debugMode, "debug", false, "whether is in debug mode")
+	flag.BoolVar(&gossipMode, "gossip", false, "whether is in gossip mode, same as -mode gossip")
+	flag.StringVar(&config.Mode, "mode", membership.MODE_ALL_TO_ALL, "heartbeat mode: all-to-all, gossip or swim")
+	flag.Float64Var(&config.MessageLossRate, "experiment", 0, "whether simulate message loss")
+	flag.DurationVar(&config.SuspicionTimeout, "suspicion", membership.SuspicionSeconds*time.Second, "time a member stays suspected before it is failed")
+	flag.StringVar(&detector, "detector", membership.DETECTOR_TIMEOUT, "failure detector: timeout or phi")
+	flag.Float64Var(&phiThreshold, "phi-threshold", membership.PhiThreshold, "phi above which a member is suspected, for the phi detector")
+	flag.StringVar(&codec, "codec", membership.CODEC_BINARY, "wire format: binary, or json for debugging")
+	flag.StringVar(&key, "key", "", "cluster key to sign messages, secondary keys for rotation follow after commas")
+	flag.StringVar(&keyFile, "key-file", "", "file of cluster keys, one per line, the first one is the primary key")
+	flag.BoolVar(&config.Encrypt, "encrypt", false, "whether encrypt messages with the cluster key, needs -key or -key-file")
+	flag.StringVar(&meta, "meta", "", "metadata of the node, e.g. role=web,zone=a")
+	flag.StringVar(&seeds, "seeds", "", "seed addresses contacted in background to heal partitions, separated by commas")
+	flag.StringVar(&config.AdminAddr, "admin", "", "address of the HTTP admin API, e.g. localhost:8080, disabled if empty")
+	// protocol parameters, they can be changed while running by the set command
+	defaults := membership.DefaultParams()
+	flag.DurationVar(&config.Params.GossipTimeout, membership.PARAM_GOSSIP_TIMEOUT, defaults.GossipTimeout, "no heartbeat for this long suspects a member, in gossip and swim mode")
+	flag.DurationVar(&config.Params.AllToAllTimeout, membership.PARAM_ALL_TO_ALL_TIMEOUT, defaults.AllToAllTimeout, "no heartbeat for this long suspects a member, in all-to-all mode")
+	flag.DurationVar(&config.Params.CleanUp, membership.PARAM_CLEANUP, defaults.CleanUp, "failed and left members are removed after this long")
+	flag.DurationVar(&config.Params.HeartbeatPeriod, membership.PARAM_HEARTBEAT_PERIOD, defaults.HeartbeatPeriod, "period of heartbeats and swim probes")
+	flag.IntVar(&config.Params.GossipRate, membership.PARAM_GOSSIP_RATE, defaults.GossipRate, "how many members a gossip is sent to")
+	flag.IntVar(&config.Params.MaxBufferSize, membership.PARAM_MAX_BUFFER_SIZE, defaults.MaxBufferSize, "max size of a message in bytes")
 	flag.Parse()
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			membership.ErrorLogger.Println(err)
+			os.Exit(1)
+		}
+	}
 
 	// if not in debug mode, discard debug output
-	if !DebugMode {
-		DebugLogger.SetOutput(ioutil.Discard)
+	if !debugMode {
+		membership.DebugLogger.SetOutput(ioutil.Discard)
+	}
+	if gossipMode {
+		config.Mode = membership.MODE_GOSSIP
+	}
+	switch detector {
+	case membership.DETECTOR_TIMEOUT:
+		config.FailureDetector = membership.NewTimeoutDetector()
+	case membership.DETECTOR_PHI:
+		config.FailureDetector = membership.NewPhiAccrualDetector(phiThreshold)
+	default:
+		membership.ErrorLogger.Println("Unknown failure detector:", detector)
+		os.Exit(1)
+	}
+	var err error
+	if config.Codec, err = membership.NewCodec(codec); err != nil {
+		membership.ErrorLogger.Println(err)
+		os.Exit(1)
+	}
+	if config.Meta, err = membership.ParseMeta(meta); err != nil {
+		membership.ErrorLogger.Println(err)
+		os.Exit(1)
+	}
+	if config.Keyring, err = loadKeyring(key, keyFile); err != nil {
+		membership.ErrorLogger.Println(err)
+		os.Exit(1)
+	}
+	if seeds != "" {
+		config.Seeds = strings.Split(seeds, ",")
 	}
-	BandwidthUsage = 0
 	// initialize local address
-	if VMMode {
-		LocalAddr = fmt.Sprintf("fa20-cs425-g07-%s.cs.illinois.edu:%s", localhost, localport)
+	if config.VMMode {
+		config.Addr = membership.VMAddr(localhost, localport)
 	} else {
-		LocalAddr = localhost + ":" + localport
+		config.Addr = localhost + ":" + localport
 	}
-
-	// initialize LocalUniqueID and membership list
-	LocalUniqueID = generateUniqueId()
-	initializeMemberInfo(LocalUniqueID, LocalAddr)
-
-	// check initialization
-	DebugLogger.Println("Check initialization:", LocalAddr, IntroducerMode, LocalUniqueID, LocalMemberList)
+	return config
 }
 
-// run background server daemon
-//	host, post: the address where server would be listening on
-// 	userCommand: a channel for user input, such as join, leave, switch
-func DaemonRun() {
-	// resolve the udp server address
-	serverAddr, err := net.ResolveUDPAddr("udp", LocalAddr)
+// set the flags not given in the command line from a JSON file, keys are the names of flags
+func loadConfigFile(path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		ErrorLogger.Println("Can't resolve address:", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("can't read config file: %v", err)
 	}
+	defer file.Close()
+	var values map[string]interface{}
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber() // keep numbers as they are written
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("invalid config file: %v", err)
+	}
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range values {
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown option in config file: %s", name)
+		}
+		if given[name] {
+			continue
+		}
+		if err := flag.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("invalid option %s in config file: %v", name, err)
+		}
+	}
+	return nil
+}
 
-	conn, err := net.ListenUDP("udp", serverAddr)
-	if err != nil {
-		ErrorLogger.Println("Failed to start server:", err.Error())
-	}
-	// output server info
-	InfoLogger.Println("Server Started at:", serverAddr.String(),
-		", Unique ID:", LocalUniqueID,
-		", IntroducerMode:", IntroducerMode,
-		", DebugMode:", DebugMode,
-		", GossipMode:", GossipMode)
-	// close connect after finishing main
-	defer conn.Close()
-
-	// create channels for taking messages and commands
-	messages := make(chan Message, 10)
-	go readMessage(conn, messages) // read messages from UDP
-	command := make(chan Command)
-	go readCommand(command) // read command from user
-
-	go RunHeartBeat()
+// load the cluster keys from the flag or the file, nil if neither is given
+func loadKeyring(key string, keyFile string) (*membership.Keyring, error) {
+	if keyFile != "" {
+		if key != "" {
+			return nil, errors.New("-key and -key-file can't be used together")
+		}
+		return membership.LoadKeyring(keyFile)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	keys := strings.Split(key, ",")
+	var secondary [][]byte
+	for _, k := range keys[1:] {
+		secondary = append(secondary, []byte(k))
+	}
+	return membership.NewKeyring([]byte(keys[0]), secondary...)
+}
 
-	// continuously, handle messages and commands, and
+// read command from user and fill it into the channel
+func readCommand(command chan membership.Command) {
+	// read input from user
+	inputReader := bufio.NewReader(os.Stdin)
+	fmt.Println("> Please enter a new command in the format of: 'Command Additional_info'")
 	for {
-		CheckFailure()
-		select {
-		case message := <-messages:
-			handleMessage(message)
-		case command := <-command:
-			handleCommand(command)
-		default:
-			time.Sleep(SleepPeriod * time.Millisecond)
+		input, err := inputReader.ReadString('\n')
+		if err != nil {
+			return // no more input, keep the daemon running
 		}
+		command <- membership.ParseCommand(input)
 	}
 }
-
-// print the Bandwidth Usage
-func PrintBandwidthUsage() {
-	InfoLogger.Println("Bandwidth Used:", BandwidthUsage, "Bytes.")
-}
\ No newline at end of file
@@ -0,0 +1,249 @@
+// This file contains the HTTP admin API, an alternative to the stdin commands.
+// Endpoints, all responses are JSON:
+//  1. GET /members: the member list, filtered by ?tag=key=value or ?tag=key
+//  2. GET /self: the local member
+//  3. POST /join: join the group, body {"Args": [...]} with the arguments of join command
+//  4. POST /leave: leave the group
+//  5. POST /mode: switch heartbeat mode, body {"Mode": "..."}, toggle if empty
+//  6. GET /stats: statistics of the node
+//  7. GET /params: the protocol parameters by name
+//  8. POST /params: change a parameter, body {"Param": "...", "Value": "...", "All": true} to spread it
+//  9. GET /metrics: metrics in the Prometheus text format, not JSON
+//
+// Changes are routed through HandleCommand, the same way as stdin commands.
+package membership
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// body of POST /join
+type joinRequest struct {
+	Args []string // pairs of vm number and port in vm mode, otherwise seed addresses
+}
+
+// body of POST /mode
+type modeRequest struct {
+	Mode string // target mode, empty to toggle between all-to-all and gossip
+}
+
+// body of POST /params
+type paramRequest struct {
+	Param string
+	Value string
+	All   bool // spread the parameters to all members
+}
+
+// response of GET /params
+type paramsResponse struct {
+	Params map[string]string
+	Epoch  int // epoch of the last spread
+}
+
+// response of GET /self
+type selfResponse struct {
+	Member    Member
+	Mode      string
+	ModeEpoch int
+	Left      bool
+	Joined    bool // whether the full member list is received from a seed
+}
+
+// response of GET /stats
+type statsResponse struct {
+	ID             string
+	Mode           string
+	ModeEpoch      int
+	BandwidthUsage int            // bytes sent
+	Members        int            // number of members, including failed and left ones
+	Statuses       map[string]int // number of members by status
+	AuthFailures   int            // messages dropped for failed authentication
+	Replays        int            // messages dropped as replays
+	HealthScore    int            // local health score, 0 is healthy
+	HealthScale    int            // timeouts are scaled by this, the score plus one
+}
+
+// response of failed requests
+type errorResponse struct {
+	Error string
+}
+
+// AdminHandler returns the HTTP handler of the admin API
+func (n *Node) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/members", adminMethod(http.MethodGet, n.handleAdminMembers))
+	mux.HandleFunc("/self", adminMethod(http.MethodGet, n.handleAdminSelf))
+	mux.HandleFunc("/join", adminMethod(http.MethodPost, n.handleAdminJoin))
+	mux.HandleFunc("/leave", adminMethod(http.MethodPost, n.handleAdminLeave))
+	mux.HandleFunc("/mode", adminMethod(http.MethodPost, n.handleAdminMode))
+	mux.HandleFunc("/stats", adminMethod(http.MethodGet, n.handleAdminStats))
+	mux.HandleFunc("/params", n.handleAdminParams)
+	mux.HandleFunc("/metrics", adminMethod(http.MethodGet, n.handleAdminMetrics))
+	return mux
+}
+
+// listen for the admin API
+func (n *Node) listenAdmin() error {
+	listener, err := net.Listen("tcp", n.config.AdminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start admin server: %v", err)
+	}
+	n.adminListener = listener
+	return nil
+}
+
+// serve the admin API until ctx is done
+func (n *Node) serveAdmin(ctx context.Context) {
+	defer n.wg.Done()
+	server := &http.Server{Handler: n.AdminHandler()}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.Serve(n.adminListener); err != nil && err != http.ErrServerClosed {
+		ErrorLogger.Println("Admin server stopped:", err)
+	}
+}
+
+// only accept the given method
+func adminMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		WarnLogger.Println("Failed to write admin response:", err)
+	}
+}
+
+// run a command and reply with the local member if it succeeds
+func (n *Node) adminCommand(w http.ResponseWriter, command Command) {
+	if err := n.HandleCommand(command); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, n.self())
+}
+
+// the local member with the state of the node
+func (n *Node) self() selfResponse {
+	member, _ := n.members.getMemberById(n.id)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return selfResponse{Member: member, Mode: n.mode, ModeEpoch: n.modeEpoch, Left: n.left, Joined: n.joined}
+}
+
+func (n *Node) handleAdminMembers(w http.ResponseWriter, r *http.Request) {
+	tags := r.URL.Query()["tag"]
+	members := make([]Member, 0)
+	for _, member := range n.Members() {
+		if matchTags(member, tags) {
+			members = append(members, member)
+		}
+	}
+	writeJSON(w, http.StatusOK, members)
+}
+
+func (n *Node) handleAdminSelf(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, n.self())
+}
+
+func (n *Node) handleAdminJoin(w http.ResponseWriter, r *http.Request) {
+	var request joinRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid body: " + err.Error()})
+		return
+	}
+	n.adminCommand(w, Command{Method: "join", Payload: request.Args})
+}
+
+func (n *Node) handleAdminLeave(w http.ResponseWriter, r *http.Request) {
+	n.adminCommand(w, Command{Method: "leave"})
+}
+
+func (n *Node) handleAdminMode(w http.ResponseWriter, r *http.Request) {
+	var request modeRequest
+	// an empty body toggles the mode
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid body: " + err.Error()})
+		return
+	}
+	command := Command{Method: "switch"}
+	if request.Mode != "" {
+		command.Payload = []string{request.Mode}
+	}
+	n.adminCommand(w, command)
+}
+
+func (n *Node) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	members := n.Members()
+	stats := statsResponse{
+		ID:          n.id,
+		Members:     len(members),
+		Statuses:    make(map[string]int),
+		HealthScore: n.health.get(),
+	}
+	stats.HealthScale = stats.HealthScore + 1
+	for _, member := range members {
+		stats.Statuses[member.Status]++
+	}
+	n.mu.Lock()
+	stats.Mode = n.mode
+	stats.ModeEpoch = n.modeEpoch
+	stats.BandwidthUsage = n.bandwidthUsage
+	n.mu.Unlock()
+	if n.auth != nil {
+		stats.AuthFailures, stats.Replays = n.auth.stats()
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// GET reads the parameters, POST changes one
+func (n *Node) handleAdminParams(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var request paramRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid body: " + err.Error()})
+			return
+		}
+		command := Command{Method: "set", Payload: []string{request.Param, request.Value}}
+		if request.All {
+			command.Payload = append(command.Payload, "all")
+		}
+		if err := n.HandleCommand(command); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+	n.mu.Lock()
+	response := paramsResponse{Params: n.params.Values(), Epoch: n.paramsEpoch}
+	n.mu.Unlock()
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (n *Node) handleAdminMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := n.WriteMetrics(w); err != nil {
+		WarnLogger.Println("Failed to write metrics:", err)
+	}
+}
@@ -0,0 +1,157 @@
+package membership
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// send a request to the admin API of the node, the clock runs until the response is written
+func (c *simCluster) admin(node int, method string, path string, body string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.nodes[node].AdminHandler().ServeHTTP(recorder, request)
+	}()
+	c.waitFor(method+" "+path, time.Minute, func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	})
+	return recorder
+}
+
+// decode the JSON body of a response with the status
+func decodeResponse(t *testing.T, recorder *httptest.ResponseRecorder, status int, body interface{}) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("status %d, want %d, body %s", recorder.Code, status, recorder.Body)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), body); err != nil {
+		t.Fatalf("invalid body %s: %v", recorder.Body, err)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	c := newSimCluster(t, 2, 1, func(index int, config *Config) {
+		if index == 0 {
+			config.Meta = map[string]string{"role": "web"}
+		}
+	})
+
+	var self selfResponse
+	decodeResponse(t, c.admin(1, http.MethodPost, "/join", `{"Args": ["`+simAddr(0)+`"]}`), http.StatusOK, &self)
+	if self.Member.ID != c.nodes[1].ID() || self.Left {
+		t.Errorf("join replied %+v", self)
+	}
+	c.waitFor("join", time.Minute, c.converged)
+
+	t.Run("members", func(t *testing.T) {
+		tests := []struct {
+			query string
+			want  int
+		}{
+			{"", 2},
+			{"?tag=role=web", 1},
+			{"?tag=role", 1},
+			{"?tag=role=db", 0},
+		}
+		for _, test := range tests {
+			var members []Member
+			decodeResponse(t, c.admin(1, http.MethodGet, "/members"+test.query, ""), http.StatusOK, &members)
+			if len(members) != test.want {
+				t.Errorf("%s: %d members, want %d", test.query, len(members), test.want)
+			}
+			if test.query == "?tag=role=web" && len(members) == 1 && members[0].ID != c.nodes[0].ID() {
+				t.Errorf("%s: got %s, want %s", test.query, members[0].ID, c.nodes[0].ID())
+			}
+		}
+	})
+
+	t.Run("self", func(t *testing.T) {
+		var self selfResponse
+		decodeResponse(t, c.admin(1, http.MethodGet, "/self", ""), http.StatusOK, &self)
+		if self.Member.ID != c.nodes[1].ID() || !self.Joined || self.Mode != MODE_ALL_TO_ALL {
+			t.Errorf("self is %+v", self)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		var stats statsResponse
+		decodeResponse(t, c.admin(1, http.MethodGet, "/stats", ""), http.StatusOK, &stats)
+		if stats.ID != c.nodes[1].ID() || stats.Members != 2 || stats.Statuses[STAT_RUNNING] != 2 || stats.HealthScale != stats.HealthScore+1 {
+			t.Errorf("stats are %+v", stats)
+		}
+	})
+
+	t.Run("mode", func(t *testing.T) {
+		tests := []struct {
+			body string
+			want string
+		}{
+			{`{"Mode": "swim"}`, MODE_SWIM},
+			{`{"Mode": "all-to-all"}`, MODE_ALL_TO_ALL},
+			{"", MODE_GOSSIP}, // an empty body toggles
+		}
+		for _, test := range tests {
+			var self selfResponse
+			decodeResponse(t, c.admin(1, http.MethodPost, "/mode", test.body), http.StatusOK, &self)
+			if self.Mode != test.want {
+				t.Errorf("%q: mode is %s, want %s", test.body, self.Mode, test.want)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			method string
+			path   string
+			body   string
+			status int
+		}{
+			{http.MethodPost, "/join", `{"Args": `, http.StatusBadRequest},
+			{http.MethodPost, "/join", `{"Args": []}`, http.StatusBadRequest},
+			{http.MethodPost, "/mode", `{"Mode": "unknown"}`, http.StatusBadRequest},
+			{http.MethodPost, "/mode", `not json`, http.StatusBadRequest},
+			{http.MethodPost, "/members", "", http.StatusMethodNotAllowed},
+			{http.MethodPost, "/self", "", http.StatusMethodNotAllowed},
+			{http.MethodPost, "/stats", "", http.StatusMethodNotAllowed},
+			{http.MethodGet, "/join", "", http.StatusMethodNotAllowed},
+			{http.MethodGet, "/leave", "", http.StatusMethodNotAllowed},
+			{http.MethodGet, "/mode", "", http.StatusMethodNotAllowed},
+		}
+		for _, test := range tests {
+			var response errorResponse
+			recorder := c.admin(1, test.method, test.path, test.body)
+			decodeResponse(t, recorder, test.status, &response)
+			if response.Error == "" {
+				t.Errorf("%s %s: no error message", test.method, test.path)
+			}
+			if test.status == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") == "" {
+				t.Errorf("%s %s: no Allow header", test.method, test.path)
+			}
+		}
+	})
+
+	t.Run("leave", func(t *testing.T) {
+		var self selfResponse
+		decodeResponse(t, c.admin(1, http.MethodPost, "/leave", ""), http.StatusOK, &self)
+		if !self.Left || self.Member.Status != STAT_LEFT {
+			t.Errorf("self is %+v after leave", self)
+		}
+		if status := c.status(0, 1); status != STAT_LEFT {
+			t.Errorf("the other node sees %s, want %s", status, STAT_LEFT)
+		}
+		var response errorResponse
+		decodeResponse(t, c.admin(1, http.MethodPost, "/leave", ""), http.StatusBadRequest, &response)
+	})
+}
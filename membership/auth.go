@@ -0,0 +1,191 @@
+// This file contains the authentication of messages with a shared cluster key.
+// When a keyring is configured, every datagram and full state message is signed:
+//
+//	magic | timestamp | nonce | message | HMAC-SHA256 of all before it
+//
+// Messages are signed with the primary key, and verified with any key of the keyring,
+// so that the key can be rotated without stopping the group.
+// A message out of the time window or with a nonce seen before is a replay.
+package membership
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// first byte of every signed message
+const authMagic = 0xA5
+
+// size of the header and the mac of a signed message
+const (
+	authHeaderSize = 1 + 8 + 8 // magic, timestamp, nonce
+	authMacSize    = sha256.Size
+)
+
+var (
+	// ErrAuthFailed is returned when a message is not signed by any key of the keyring
+	ErrAuthFailed = errors.New("message authentication failed")
+	// ErrReplay is returned when a message is out of the time window or seen before
+	ErrReplay = errors.New("message replayed")
+)
+
+// Keyring holds the cluster keys, the primary key first.
+type Keyring struct {
+	keys [][]byte
+}
+
+// create a keyring, messages are signed with the primary key and verified with all keys
+func NewKeyring(primary []byte, secondary ...[]byte) (*Keyring, error) {
+	keys := append([][]byte{primary}, secondary...)
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, errors.New("empty cluster key")
+		}
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+// load a keyring from a file, one key per line, the first one is the primary key
+func LoadKeyring(path string) (*Keyring, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var keys [][]byte
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			keys = append(keys, []byte(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no cluster key in %s", path)
+	}
+	return NewKeyring(keys[0], keys[1:]...)
+}
+
+// signs and verifies the messages of a node, and remembers the nonces seen
+type authenticator struct {
+	keyring *Keyring
+	ciphers []cipher.AEAD // by the order of keys, nil if messages are not encrypted
+	clock   Clock         // timestamps of messages
+
+	mu        sync.Mutex
+	seen      map[uint64]time.Time // nonces in the time window, by their timestamp
+	lastPrune time.Time            // when nonces out of the window were forgotten
+	failures  int                  // messages failed verification
+	replays   int                  // messages replayed
+}
+
+// create an authenticator of the keyring, messages are encrypted as well if encrypt is set
+func newAuthenticator(keyring *Keyring, encrypt bool, clock Clock) (*authenticator, error) {
+	a := &authenticator{keyring: keyring, clock: clock, seen: make(map[uint64]time.Time)}
+	if encrypt {
+		ciphers, err := newCiphers(keyring)
+		if err != nil {
+			return nil, err
+		}
+		a.ciphers = ciphers
+	}
+	return a, nil
+}
+
+// size added to a message by sign and encrypt
+func (a *authenticator) overhead() int {
+	if a.ciphers != nil {
+		return authHeaderSize + authMacSize + encryptOverhead
+	}
+	return authHeaderSize + authMacSize
+}
+
+// sign a message with the primary key
+func (a *authenticator) sign(message []byte) []byte {
+	signed := make([]byte, authHeaderSize, authHeaderSize+len(message)+authMacSize)
+	signed[0] = authMagic
+	binary.BigEndian.PutUint64(signed[1:], uint64(a.clock.Now().UnixNano()))
+	if _, err := rand.Read(signed[9:authHeaderSize]); err != nil {
+		ErrorLogger.Println("Failed to generate nonce:", err)
+	}
+	signed = append(signed, message...)
+	return append(signed, computeMac(a.keyring.keys[0], signed)...)
+}
+
+// verify a signed message and return the message inside
+func (a *authenticator) verify(signed []byte) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(signed) < authHeaderSize+authMacSize || signed[0] != authMagic {
+		a.failures++
+		return nil, fmt.Errorf("%w: not signed", ErrAuthFailed)
+	}
+	body, mac := signed[:len(signed)-authMacSize], signed[len(signed)-authMacSize:]
+	verified := false
+	for _, key := range a.keyring.keys {
+		if hmac.Equal(mac, computeMac(key, body)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		a.failures++
+		return nil, ErrAuthFailed
+	}
+
+	// check the time window and the nonce
+	timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(body[1:])))
+	nonce := binary.BigEndian.Uint64(body[9:])
+	now := a.clock.Now()
+	if skew := now.Sub(timestamp); skew > AuthWindowSeconds*time.Second || skew < -AuthWindowSeconds*time.Second {
+		a.replays++
+		return nil, fmt.Errorf("%w: timestamp out of window", ErrReplay)
+	}
+	if _, ok := a.seen[nonce]; ok {
+		a.replays++
+		return nil, ErrReplay
+	}
+	a.seen[nonce] = timestamp
+	// forget nonces out of the window, they are rejected by the timestamp
+	if now.Sub(a.lastPrune) > AuthWindowSeconds*time.Second {
+		for seenNonce, seenTime := range a.seen {
+			if now.Sub(seenTime) > AuthWindowSeconds*time.Second {
+				delete(a.seen, seenNonce)
+			}
+		}
+		a.lastPrune = now
+	}
+	return body[authHeaderSize:], nil
+}
+
+func (a *authenticator) countFailure() {
+	a.mu.Lock()
+	a.failures++
+	a.mu.Unlock()
+}
+
+// statistics of dropped messages
+func (a *authenticator) stats() (failures int, replays int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.failures, a.replays
+}
+
+// HMAC-SHA256 of data with the key
+func computeMac(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,107 @@
+package membership
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestAuthenticator(t *testing.T, clock Clock, keys ...string) *authenticator {
+	t.Helper()
+	var secondary [][]byte
+	for _, key := range keys[1:] {
+		secondary = append(secondary, []byte(key))
+	}
+	keyring, err := NewKeyring([]byte(keys[0]), secondary...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := newAuthenticator(keyring, false, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// a signed datagram is accepted once, within the time window, and only with a valid mac
+func TestAuthVerify(t *testing.T) {
+	window := AuthWindowSeconds * time.Second
+	tests := []struct {
+		name     string
+		skew     time.Duration // of the clock of the sender
+		delay    time.Duration // until the datagram is received
+		tamper   func(signed []byte) []byte
+		twice    bool // the datagram is received a second time
+		err      error
+		failures int
+		replays  int
+	}{
+		{name: "valid"},
+		{name: "within the window", delay: window - time.Second},
+		{name: "replayed", twice: true, err: ErrReplay, replays: 1},
+		{name: "late", delay: window + time.Second, err: ErrReplay, replays: 1},
+		{name: "from the future", skew: window + time.Second, err: ErrReplay, replays: 1},
+		{name: "forged mac", tamper: func(signed []byte) []byte {
+			signed[len(signed)-1] ^= 0x01
+			return signed
+		}, err: ErrAuthFailed, failures: 1},
+		{name: "forged message", tamper: func(signed []byte) []byte {
+			signed[authHeaderSize] ^= 0x01
+			return signed
+		}, err: ErrAuthFailed, failures: 1},
+		{name: "forged timestamp", tamper: func(signed []byte) []byte {
+			signed[1] ^= 0x01
+			return signed
+		}, err: ErrAuthFailed, failures: 1},
+		{name: "truncated", tamper: func(signed []byte) []byte {
+			return signed[:authHeaderSize+authMacSize-1]
+		}, err: ErrAuthFailed, failures: 1},
+		{name: "not signed", tamper: func(signed []byte) []byte {
+			return []byte("a plain datagram which is long enough to hold a header and a mac")
+		}, err: ErrAuthFailed, failures: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			senderClock := NewFakeClock(time.Unix(1000, 0).Add(test.skew))
+			receiverClock := NewFakeClock(time.Unix(1000, 0))
+			sender := newTestAuthenticator(t, senderClock, "key")
+			receiver := newTestAuthenticator(t, receiverClock, "key")
+
+			signed := sender.sign([]byte("message"))
+			if test.tamper != nil {
+				signed = test.tamper(signed)
+			}
+			receiverClock.Advance(test.delay)
+			message, err := receiver.verify(signed)
+			if test.twice && err == nil {
+				_, err = receiver.verify(signed)
+			} else if err == nil && string(message) != "message" {
+				t.Errorf("verified %q, want %q", message, "message")
+			}
+			if test.err == nil && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+			if failures, replays := receiver.stats(); failures != test.failures || replays != test.replays {
+				t.Errorf("counted %d failures and %d replays, want %d and %d", failures, replays, test.failures, test.replays)
+			}
+		})
+	}
+}
+
+// a datagram signed with a key the receiver doesn't hold is counted as a failure, not a replay
+func TestAuthOtherKey(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	sender := newTestAuthenticator(t, clock, "other")
+	receiver := newTestAuthenticator(t, clock, "key", "old")
+	for i := 0; i < 3; i++ {
+		if _, err := receiver.verify(sender.sign([]byte("message"))); !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("got %v, want %v", err, ErrAuthFailed)
+		}
+	}
+	if failures, replays := receiver.stats(); failures != 3 || replays != 0 {
+		t.Errorf("counted %d failures and %d replays, want 3 and 0", failures, replays)
+	}
+}
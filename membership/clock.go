@@ -0,0 +1,171 @@
+// This file contains the clocks.
+// A node reads the time and waits only through its clock.
+// The real clock is the system clock, and the fake clock only moves when it is advanced,
+// so that simulations are deterministic and do not wait in real time.
+package membership
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and runs functions after a delay, it must be safe for concurrent use
+type Clock interface {
+	Now() time.Time
+	// run f after d, in its own goroutine or when the clock is advanced
+	AfterFunc(d time.Duration, f func())
+	// the channel receives the time after d
+	After(d time.Duration) <-chan time.Time
+	// a ticker ticking every d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a clock, ticks are dropped if the reader falls behind
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// the system clock
+type realClock struct{}
+
+// create a clock of the system time
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) {
+	time.AfterFunc(d, f)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// a function waiting for the fake clock
+type fakeTimer struct {
+	at  time.Time
+	seq int // functions at the same time run in the order they were added
+	f   func()
+}
+
+// FakeClock is a clock which only moves when it is advanced.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers []fakeTimer
+}
+
+// create a fake clock starting at the given time
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), seq: c.seq, f: f})
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.AfterFunc(d, func() { ch <- c.Now() })
+	return ch
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	ticker := &fakeTicker{clock: c, period: d, ch: make(chan time.Time, 1)}
+	c.AfterFunc(d, ticker.tick)
+	return ticker
+}
+
+// a ticker of the fake clock, it schedules the next tick on every tick
+type fakeTicker struct {
+	clock  *FakeClock
+	period time.Duration
+	ch     chan time.Time
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+}
+
+func (t *fakeTicker) tick() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	select {
+	case t.ch <- t.clock.Now():
+	default:
+	}
+	t.clock.AfterFunc(t.period, t.tick)
+}
+
+// Advance moves the clock forward, functions due are run in order of their time
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		sort.Slice(c.timers, func(i, j int) bool {
+			if !c.timers[i].at.Equal(c.timers[j].at) {
+				return c.timers[i].at.Before(c.timers[j].at)
+			}
+			return c.timers[i].seq < c.timers[j].seq
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+		if timer.at.After(c.now) {
+			c.now = timer.at
+		}
+		c.mu.Unlock()
+		// run without the lock, so that f can add more functions
+		timer.f()
+	}
+}
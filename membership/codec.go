@@ -0,0 +1,300 @@
+// This file contains the codecs used to serialize messages and member lists.
+// Two codecs:
+//  1. Binary codec: compact, the default on the wire
+//  2. JSON codec: human readable, for debugging
+//
+// Both carry ProtocolVersion, and messages of another version are rejected.
+package membership
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// version of the wire protocol, bump it when the format of messages changes
+const ProtocolVersion = 5
+
+// codec names, used by flags
+const (
+	CODEC_BINARY = "binary"
+	CODEC_JSON   = "json"
+)
+
+// first byte of every binary message
+const binaryMagic = 0xB7
+
+// ErrVersionMismatch is returned when a message of another protocol version or codec is decoded
+var ErrVersionMismatch = errors.New("protocol version mismatch")
+
+// Codec serializes messages and member lists
+type Codec interface {
+	Name() string
+	EncodeMessage(message Message) ([]byte, error)
+	DecodeMessage(data []byte) (Message, error)
+	// member lists are encoded into message payloads
+	EncodeMembers(members []Member) ([]byte, error)
+	DecodeMembers(data []byte) ([]Member, error)
+}
+
+// create a codec by its name
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case CODEC_BINARY:
+		return BinaryCodec{}, nil
+	case CODEC_JSON:
+		return JSONCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown codec: %s", name)
+	}
+}
+
+// JSONCodec encodes messages as JSON, only for debugging
+type JSONCodec struct{}
+
+// message with a version on the wire
+type jsonEnvelope struct {
+	Version int
+	Message
+}
+
+func (JSONCodec) Name() string {
+	return CODEC_JSON
+}
+
+func (JSONCodec) EncodeMessage(message Message) ([]byte, error) {
+	return json.Marshal(jsonEnvelope{Version: ProtocolVersion, Message: message})
+}
+
+func (JSONCodec) DecodeMessage(data []byte) (Message, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return Message{}, ErrVersionMismatch
+	}
+	var envelope jsonEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Message{}, err
+	}
+	if envelope.Version != ProtocolVersion {
+		return Message{}, fmt.Errorf("%w: got version %d", ErrVersionMismatch, envelope.Version)
+	}
+	return envelope.Message, nil
+}
+
+func (JSONCodec) EncodeMembers(members []Member) ([]byte, error) {
+	return json.Marshal(members)
+}
+
+func (JSONCodec) DecodeMembers(data []byte) ([]Member, error) {
+	var members []Member
+	err := json.Unmarshal(data, &members)
+	return members, err
+}
+
+// BinaryCodec encodes messages in a compact binary format.
+// Strings and payloads are prefixed by their length as uvarint, numbers are varints.
+// Metadata is a count followed by key and value strings, sorted by key.
+// Timestamps of members are local and never sent.
+type BinaryCodec struct{}
+
+// statuses on the wire
+var statusCodes = []string{STAT_RUNNING, STAT_SUSPECT, STAT_LEFT, STAT_FAILED}
+
+func (BinaryCodec) Name() string {
+	return CODEC_BINARY
+}
+
+func (BinaryCodec) EncodeMessage(message Message) ([]byte, error) {
+	buffer := make([]byte, 0, 32+len(message.SenderID)+len(message.SenderAddr)+len(message.Payload)+len(message.Mode))
+	buffer = append(buffer, binaryMagic, ProtocolVersion)
+	buffer = appendString(buffer, message.Method)
+	buffer = appendString(buffer, message.SenderID)
+	buffer = appendString(buffer, message.SenderAddr)
+	buffer = appendBytes(buffer, message.Payload)
+	buffer = appendString(buffer, message.Mode)
+	buffer = appendVarint(buffer, int64(message.ModeEpoch))
+	return buffer, nil
+}
+
+func (BinaryCodec) DecodeMessage(data []byte) (Message, error) {
+	if len(data) < 2 || data[0] != binaryMagic {
+		return Message{}, ErrVersionMismatch
+	}
+	if data[1] != ProtocolVersion {
+		return Message{}, fmt.Errorf("%w: got version %d", ErrVersionMismatch, data[1])
+	}
+	reader := binaryReader{data: data[2:]}
+	message := Message{
+		Method:     reader.readString(),
+		SenderID:   reader.readString(),
+		SenderAddr: reader.readString(),
+		Payload:    reader.readBytes(),
+		Mode:       reader.readString(),
+		ModeEpoch:  int(reader.readVarint()),
+	}
+	return message, reader.err
+}
+
+func (BinaryCodec) EncodeMembers(members []Member) ([]byte, error) {
+	buffer := appendUvarint(nil, uint64(len(members)))
+	for _, member := range members {
+		status := -1
+		for code, name := range statusCodes {
+			if name == member.Status {
+				status = code
+			}
+		}
+		if status < 0 {
+			return nil, fmt.Errorf("unknown status %q of member %s", member.Status, member.ID)
+		}
+		buffer = appendString(buffer, member.ID)
+		buffer = appendString(buffer, member.Addr)
+		buffer = appendVarint(buffer, int64(member.HeartbeatCounter))
+		buffer = appendVarint(buffer, int64(member.Incarnation))
+		buffer = append(buffer, byte(status))
+		buffer = appendVarint(buffer, int64(member.MetaVersion))
+		buffer = appendUvarint(buffer, uint64(len(member.Meta)))
+		keys := make([]string, 0, len(member.Meta))
+		for key := range member.Meta {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buffer = appendString(buffer, key)
+			buffer = appendString(buffer, member.Meta[key])
+		}
+	}
+	return buffer, nil
+}
+
+func (BinaryCodec) DecodeMembers(data []byte) ([]Member, error) {
+	reader := binaryReader{data: data}
+	count := reader.readUvarint()
+	// every member takes more than one byte, do not trust a count larger than that
+	if count > uint64(len(data)) {
+		return nil, errors.New("binary codec: invalid member count")
+	}
+	members := make([]Member, 0, count)
+	for i := uint64(0); i < count && reader.err == nil; i++ {
+		member := Member{
+			ID:               reader.readString(),
+			Addr:             reader.readString(),
+			HeartbeatCounter: int(reader.readVarint()),
+			Incarnation:      int(reader.readVarint()),
+		}
+		status := int(reader.readByte())
+		if reader.err == nil && status >= len(statusCodes) {
+			return nil, fmt.Errorf("binary codec: unknown status code %d", status)
+		}
+		member.MetaVersion = int(reader.readVarint())
+		metaCount := reader.readUvarint()
+		if metaCount > MaxMetaEntries {
+			return nil, errors.New("binary codec: too many metadata entries")
+		}
+		if metaCount > 0 {
+			member.Meta = make(map[string]string, metaCount)
+			for j := uint64(0); j < metaCount; j++ {
+				key := reader.readString()
+				member.Meta[key] = reader.readString()
+			}
+		}
+		if reader.err == nil {
+			member.Status = statusCodes[status]
+			members = append(members, member)
+		}
+	}
+	return members, reader.err
+}
+
+func appendUvarint(buffer []byte, value uint64) []byte {
+	var varintBuffer [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(varintBuffer[:], value)
+	return append(buffer, varintBuffer[:size]...)
+}
+
+func appendVarint(buffer []byte, value int64) []byte {
+	var varintBuffer [binary.MaxVarintLen64]byte
+	size := binary.PutVarint(varintBuffer[:], value)
+	return append(buffer, varintBuffer[:size]...)
+}
+
+func appendString(buffer []byte, s string) []byte {
+	buffer = appendUvarint(buffer, uint64(len(s)))
+	return append(buffer, s...)
+}
+
+func appendBytes(buffer []byte, b []byte) []byte {
+	buffer = appendUvarint(buffer, uint64(len(b)))
+	return append(buffer, b...)
+}
+
+// read binary data, the first error is kept and all following reads return zero values
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+var errShortBuffer = errors.New("binary codec: message is truncated")
+
+func (r *binaryReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		r.err = errShortBuffer
+		return 0
+	}
+	r.data = r.data[size:]
+	return value
+}
+
+func (r *binaryReader) readVarint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	value, size := binary.Varint(r.data)
+	if size <= 0 {
+		r.err = errShortBuffer
+		return 0
+	}
+	r.data = r.data[size:]
+	return value
+}
+
+func (r *binaryReader) readByte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errShortBuffer
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+// read a length-prefixed slice, the returned slice is a copy
+func (r *binaryReader) readBytes() []byte {
+	length := r.readUvarint()
+	if r.err != nil {
+		return nil
+	}
+	if length > uint64(len(r.data)) {
+		r.err = errShortBuffer
+		return nil
+	}
+	if length == 0 {
+		return nil
+	}
+	b := make([]byte, length)
+	copy(b, r.data)
+	r.data = r.data[length:]
+	return b
+}
+
+func (r *binaryReader) readString() string {
+	return string(r.readBytes())
+}
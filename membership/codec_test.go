@@ -0,0 +1,115 @@
+package membership
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// a gossip heartbeat of size members, as sent in gossip mode
+func heartbeatMembers(size int) []Member {
+	members := make([]Member, size)
+	for i := range members {
+		members[i] = Member{
+			ID:               fmt.Sprintf("172.22.94.%d:2333-1633046400", i),
+			Addr:             fmt.Sprintf("172.22.94.%d:2333", i),
+			HeartbeatCounter: 1000 + i,
+			Incarnation:      i % 3,
+			Status:           statusCodes[i%len(statusCodes)],
+		}
+	}
+	members[0].Meta = map[string]string{"role": "web", "zone": "a"}
+	members[0].MetaVersion = 2
+	return members
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	message := Message{
+		Method:     MSG_PING,
+		SenderID:   "172.22.94.1:2333-1633046400",
+		SenderAddr: "172.22.94.1:2333",
+		Payload:    []byte{1, 2, 3},
+		Mode:       MODE_GOSSIP,
+		ModeEpoch:  3,
+	}
+	members := heartbeatMembers(5)
+	for _, codec := range []Codec{BinaryCodec{}, JSONCodec{}} {
+		data, err := codec.EncodeMessage(message)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		decoded, err := codec.DecodeMessage(data)
+		if err != nil || !reflect.DeepEqual(decoded, message) {
+			t.Errorf("%s: decoded message %+v, %v", codec.Name(), decoded, err)
+		}
+		data, err = codec.EncodeMembers(members)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		decodedMembers, err := codec.DecodeMembers(data)
+		if err != nil || !reflect.DeepEqual(decodedMembers, members) {
+			t.Errorf("%s: decoded members %+v, %v", codec.Name(), decodedMembers, err)
+		}
+	}
+}
+
+func TestCodecVersionMismatch(t *testing.T) {
+	message := Message{Method: MSG_PING, SenderID: "a", SenderAddr: "a:1"}
+	binaryData, _ := BinaryCodec{}.EncodeMessage(message)
+	jsonData, _ := JSONCodec{}.EncodeMessage(message)
+	oldBinary := append([]byte(nil), binaryData...)
+	oldBinary[1] = ProtocolVersion - 1
+	tests := []struct {
+		name  string
+		codec Codec
+		data  []byte
+	}{
+		{"binary reads json", BinaryCodec{}, jsonData},
+		{"json reads binary", JSONCodec{}, binaryData},
+		{"binary reads an old version", BinaryCodec{}, oldBinary},
+		{"json reads an old version", JSONCodec{}, []byte(fmt.Sprintf(`{"Version":%d,"Method":"PING"}`, ProtocolVersion-1))},
+		{"binary reads nothing", BinaryCodec{}, nil},
+	}
+	for _, test := range tests {
+		if _, err := test.codec.DecodeMessage(test.data); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("%s: got %v, want ErrVersionMismatch", test.name, err)
+		}
+	}
+}
+
+func TestCodecTruncated(t *testing.T) {
+	data, _ := BinaryCodec{}.EncodeMembers(heartbeatMembers(3))
+	for size := 0; size < len(data); size++ {
+		if _, err := (BinaryCodec{}).DecodeMembers(data[:size]); err == nil {
+			t.Errorf("decoded %d of %d bytes without error", size, len(data))
+		}
+	}
+}
+
+// bytes of an all-to-all heartbeat, a ping without payload
+func benchmarkPing(b *testing.B, codec Codec) {
+	message := Message{Method: MSG_PING, SenderID: "172.22.94.1:2333-1633046400", SenderAddr: "172.22.94.1:2333", Mode: MODE_ALL_TO_ALL}
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		data, _ = codec.EncodeMessage(message)
+	}
+	b.ReportMetric(float64(len(data)), "bytes/msg")
+}
+
+// bytes of a gossip heartbeat carrying size members
+func benchmarkGossip(b *testing.B, codec Codec, size int) {
+	members := heartbeatMembers(size)
+	message := Message{Method: MSG_PING, SenderID: members[0].ID, SenderAddr: members[0].Addr, Mode: MODE_GOSSIP}
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		message.Payload, _ = codec.EncodeMembers(members)
+		data, _ = codec.EncodeMessage(message)
+	}
+	b.ReportMetric(float64(len(data)), "bytes/msg")
+}
+
+func BenchmarkCodecBinaryPing(b *testing.B)     { benchmarkPing(b, BinaryCodec{}) }
+func BenchmarkCodecJSONPing(b *testing.B)       { benchmarkPing(b, JSONCodec{}) }
+func BenchmarkCodecBinaryGossip10(b *testing.B) { benchmarkGossip(b, BinaryCodec{}, 10) }
+func BenchmarkCodecJSONGossip10(b *testing.B)   { benchmarkGossip(b, JSONCodec{}, 10) }
@@ -0,0 +1,181 @@
+// This file contains command-related structs and functions.
+// Possible commands:
+//  1. send address message
+//  2. join seed_address...
+//  3. leave
+//  4. display member [key=value...]/id/params
+//  5. switch [all-to-all/gossip/swim]
+//  6. meta key [value]
+//  7. set param value [all]
+package membership
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Command from user input
+type Command struct {
+	Method  string
+	Payload []string
+}
+
+// parse a line of user input into a command
+func ParseCommand(input string) Command {
+	inputs := strings.Split(strings.TrimSpace(input), " ")
+	return Command{inputs[0], inputs[1:]}
+}
+
+// HandleCommand handles and dispatches a command, it is shared by stdin and the admin API
+func (n *Node) HandleCommand(command Command) error {
+	switch command.Method {
+	case "join":
+		return n.handleCommandJoin(command)
+	case "leave":
+		return n.handleCommandLeave(command)
+	case "send":
+		return n.handleCommandSend(command)
+	case "switch":
+		return n.handleCommandSwitch(command)
+	case "display":
+		return n.handleCommandDisplay(command)
+	case "meta":
+		return n.handleCommandMeta(command)
+	case "set":
+		return n.handleCommandSet(command)
+	default:
+		return errors.New("unsupported command")
+	}
+}
+
+// handle send command
+// send command will send the given message to a given remote host
+// ps: this is only for test purpose
+func (n *Node) handleCommandSend(command Command) error {
+	if len(command.Payload) == 0 {
+		return errors.New("invalid send arguments")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.transport == nil {
+		return errors.New("can't send before the node is started")
+	}
+
+	DebugLogger.Println("Sent Command!")
+	err := n.transport.WriteTo([]byte(strings.Join(command.Payload[1:], " ")), command.Payload[0])
+	if err != nil {
+		return fmt.Errorf("failed to write to udp: %v", err)
+	}
+	return nil
+}
+
+// handle join command
+// this would join through the given seeds, any running member can be a seed
+func (n *Node) handleCommandJoin(command Command) error {
+	if len(command.Payload) == 0 {
+		return errors.New("invalid join arguments")
+	}
+	// if join vm, the seeds are given in pairs of vm number and port
+	if n.config.VMMode {
+		if len(command.Payload)%2 != 0 {
+			return errors.New("invalid join arguments, want pairs of vm number and port")
+		}
+		var seeds []string
+		for i := 0; i < len(command.Payload); i += 2 {
+			seeds = append(seeds, VMAddr(command.Payload[i], command.Payload[i+1]))
+		}
+		return n.Join(seeds...)
+	}
+	// if join other remote hosts
+	return n.Join(command.Payload...)
+}
+
+// handle leave command, the node keeps running after it left
+func (n *Node) handleCommandLeave(command Command) error {
+	if err := n.Leave(); errors.Is(err, ErrLeaveIncomplete) {
+		// the node has left, the rest of members learn it by gossip or time it out
+		WarnLogger.Println(err)
+	} else if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.printBandwidthUsage()
+	n.mu.Unlock()
+	return nil
+}
+
+// change the heartbeat mode, toggle between all-to-all and gossip if no mode is given
+func (n *Node) handleCommandSwitch(command Command) error {
+	target := ""
+	if len(command.Payload) > 0 {
+		target = command.Payload[0]
+		if !isValidMode(target) {
+			return fmt.Errorf("invalid switch argument: %s", target)
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// a new epoch, so that the switch overrides the mode of all members
+	n.adoptMode(nextMode(n.mode, target), n.modeEpoch+1)
+
+	n.broadcastMessage(Message{Method: MSG_SWITCH})
+	InfoLogger.Println("Switched to", n.mode, "heartbeat style.")
+	return nil
+}
+
+// handle display command
+// display member or id, members can be filtered by tags of key=value or key
+func (n *Node) handleCommandDisplay(command Command) error {
+	if len(command.Payload) == 0 {
+		return errors.New("empty display argument")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch command.Payload[0] {
+	case "member":
+		n.printMemberList(command.Payload[1:]...)
+	case "id":
+		fmt.Println("The unique ID is:", n.id)
+	case "params":
+		fmt.Printf("Parameters at epoch %d: \n", n.paramsEpoch)
+		n.params.print()
+	default:
+		return fmt.Errorf("invalid display argument: %s", command.Payload[0])
+	}
+	return nil
+}
+
+// handle meta command
+// set a metadata entry of this node, or remove it if no value is given
+func (n *Node) handleCommandMeta(command Command) error {
+	if len(command.Payload) == 0 || len(command.Payload) > 2 {
+		return errors.New("invalid meta arguments")
+	}
+	value := ""
+	if len(command.Payload) == 2 {
+		value = command.Payload[1]
+	}
+	return n.SetMeta(command.Payload[0], value)
+}
+
+// handle set command
+// change a protocol parameter of this node, or of all members if followed by all
+func (n *Node) handleCommandSet(command Command) error {
+	if len(command.Payload) < 2 || len(command.Payload) > 3 {
+		return errors.New("invalid set arguments")
+	}
+	spread := false
+	if len(command.Payload) == 3 {
+		if command.Payload[2] != "all" {
+			return fmt.Errorf("invalid set argument: %s", command.Payload[2])
+		}
+		spread = true
+	}
+	return n.SetParam(command.Payload[0], command.Payload[1], spread)
+}
+
+// address of a vm from its number and port
+func VMAddr(vmNumber string, port string) string {
+	return fmt.Sprintf("fa20-cs425-g07-%s.cs.illinois.edu:%s", vmNumber, port)
+}
@@ -0,0 +1,47 @@
+package membership
+
+import (
+	"testing"
+)
+
+// in vm mode, join takes one or more pairs of vm number and port, each pair is a seed
+func TestCommandJoinVM(t *testing.T) {
+	tests := []struct {
+		input string
+		seeds []string // nil if the arguments are invalid
+	}{
+		{"join 02 8001", []string{VMAddr("02", "8001")}},
+		{"join 02 8001 03 8002", []string{VMAddr("02", "8001"), VMAddr("03", "8002")}},
+		{"join 02 8001 03", nil},
+		{"join", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			c := newSimCluster(t, 1, 1, func(index int, config *Config) {
+				config.VMMode = true
+			})
+			n := c.nodes[0]
+			err := n.HandleCommand(ParseCommand(test.input))
+			if test.seeds == nil {
+				if err == nil {
+					t.Error("invalid join arguments are accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n.mu.Lock()
+			seeds := append([]string(nil), n.seeds...)
+			n.mu.Unlock()
+			if len(seeds) != len(test.seeds) {
+				t.Fatalf("joining through %v, want %v", seeds, test.seeds)
+			}
+			for i := range seeds {
+				if seeds[i] != test.seeds[i] {
+					t.Errorf("joining through %v, want %v", seeds, test.seeds)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// This file contains the failure detectors used by checkFailure.
+// Two detectors:
+//  1. Timeout detector: a member is suspected after a fixed timeout
+//  2. Phi accrual detector: a member is suspected when phi, the suspicion level
+//     computed from its history of heartbeat inter-arrival times, is too high
+package membership
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// FailureDetector decides whether a running member should be suspected.
+// A detector belongs to a single node, and must be safe for concurrent use.
+type FailureDetector interface {
+	// record the arrival of a heartbeat from a member
+	Heartbeat(id string, arrival time.Time)
+	// whether the member should be suspected, timeout is the timeout of current heartbeat mode
+	Suspect(member Member, timeout time.Duration, now time.Time) bool
+	// forget a member removed from the member list
+	Remove(id string)
+}
+
+// failure detector names, used by flags
+const (
+	DETECTOR_TIMEOUT = "timeout"
+	DETECTOR_PHI     = "phi"
+)
+
+// phi accrual related
+const (
+	PhiThreshold     = 8.0 // default phi above which a member is suspected
+	PhiWindowSize    = 100 // max number of inter-arrival samples kept per member
+	PhiMinSamples    = 3   // min number of samples before phi is used
+	PhiMinStdDevMils = 100 // lower bound of standard deviation in milliseconds
+	PhiMaxIntervals  = 10  // a gap this many times longer than the mean starts the history over
+)
+
+// timeout detector, the default detector
+type timeoutDetector struct{}
+
+// create a detector which suspects a member after a fixed timeout
+func NewTimeoutDetector() FailureDetector {
+	return timeoutDetector{}
+}
+
+func (timeoutDetector) Heartbeat(id string, arrival time.Time) {}
+
+func (timeoutDetector) Suspect(member Member, timeout time.Duration, now time.Time) bool {
+	return now.Sub(member.Timestamp) > timeout
+}
+
+func (timeoutDetector) Remove(id string) {}
+
+// heartbeat history of a member
+type arrivalHistory struct {
+	last      time.Time // last arrival
+	intervals []float64 // inter-arrival times in milliseconds
+}
+
+// mean of the inter-arrival times in milliseconds, 0 if there is no sample
+func (h *arrivalHistory) mean() float64 {
+	if len(h.intervals) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, interval := range h.intervals {
+		sum += interval
+	}
+	return sum / float64(len(h.intervals))
+}
+
+// PhiAccrualDetector implements the phi accrual failure detector.
+type PhiAccrualDetector struct {
+	mu        sync.Mutex
+	threshold float64
+	histories map[string]*arrivalHistory
+}
+
+// create a phi accrual detector, members with phi above threshold are suspected
+func NewPhiAccrualDetector(threshold float64) *PhiAccrualDetector {
+	if threshold <= 0 {
+		threshold = PhiThreshold
+	}
+	return &PhiAccrualDetector{
+		threshold: threshold,
+		histories: make(map[string]*arrivalHistory),
+	}
+}
+
+func (d *PhiAccrualDetector) Heartbeat(id string, arrival time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	history := d.histories[id]
+	if history == nil {
+		d.histories[id] = &arrivalHistory{last: arrival}
+		return
+	}
+	interval := float64(arrival.Sub(history.last)) / float64(time.Millisecond)
+	history.last = arrival
+	if interval <= 0 {
+		return
+	}
+	// a long gap is not a heartbeat interval, e.g. after a pause or a mode switch, or the heartbeat period grew:
+	// the history starts over from the next arrival. A shorter period takes over the window sample by sample.
+	// A gap is only judged against a history of PhiMinSamples samples.
+	if len(history.intervals) >= PhiMinSamples && interval > PhiMaxIntervals*history.mean() {
+		history.intervals = history.intervals[:0]
+		return
+	}
+	history.intervals = append(history.intervals, interval)
+	if len(history.intervals) > PhiWindowSize {
+		history.intervals = history.intervals[1:]
+	}
+}
+
+func (d *PhiAccrualDetector) Suspect(member Member, timeout time.Duration, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	history := d.histories[member.ID]
+	// fall back to fixed timeout if there is not enough history
+	if history == nil || len(history.intervals) < PhiMinSamples {
+		return now.Sub(member.Timestamp) > timeout
+	}
+	return d.phi(member.ID, now) > d.threshold
+}
+
+func (d *PhiAccrualDetector) Remove(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.histories, id)
+}
+
+// Phi returns the current suspicion level of a member, 0 if its history is too short
+func (d *PhiAccrualDetector) Phi(id string, now time.Time) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.phi(id, now)
+}
+
+func (d *PhiAccrualDetector) phi(id string, now time.Time) float64 {
+	history := d.histories[id]
+	if history == nil || len(history.intervals) < PhiMinSamples {
+		return 0
+	}
+	// mean and standard deviation of inter-arrival times
+	var squareSum float64
+	for _, interval := range history.intervals {
+		squareSum += interval * interval
+	}
+	count := float64(len(history.intervals))
+	mean := history.mean()
+	stdDev := math.Sqrt(math.Max(squareSum/count-mean*mean, 0))
+	stdDev = math.Max(stdDev, PhiMinStdDevMils)
+
+	// phi = -log10(1 - F(elapsed)), F is approximated by a logistic function of the normal distribution
+	elapsed := float64(now.Sub(history.last)) / float64(time.Millisecond)
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1.0 + e))
+	}
+	return -math.Log10(1.0 - 1.0/(1.0+e))
+}
@@ -0,0 +1,157 @@
+package membership
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// a timeout detector which records the arrivals it is given
+type recordingDetector struct {
+	timeoutDetector
+	mu       sync.Mutex
+	arrivals map[string][]time.Time
+}
+
+func (d *recordingDetector) Heartbeat(id string, arrival time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.arrivals[id] = append(d.arrivals[id], arrival)
+}
+
+func (d *recordingDetector) intervals(id string) []time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var intervals []time.Duration
+	for i := 1; i < len(d.arrivals[id]); i++ {
+		intervals = append(intervals, d.arrivals[id][i].Sub(d.arrivals[id][i-1]))
+	}
+	return intervals
+}
+
+// the detector is given one arrival per heartbeat period of a member, as the node receives them,
+// pongs and join acks reply to the local node and are not heartbeats of the member
+func TestDetectorArrivals(t *testing.T) {
+	for _, mode := range []string{MODE_ALL_TO_ALL, MODE_GOSSIP} {
+		t.Run(mode, func(t *testing.T) {
+			detectors := make([]*recordingDetector, 2)
+			c := newSimCluster(t, 2, 1, func(index int, config *Config) {
+				detectors[index] = &recordingDetector{arrivals: make(map[string][]time.Time)}
+				config.FailureDetector = detectors[index]
+				config.Mode = mode
+			})
+			c.joinAll()
+			c.waitFor("convergence", time.Minute, c.converged)
+			c.run(30 * time.Second)
+
+			period := DefaultParams().HeartbeatPeriod
+			intervals := detectors[0].intervals(c.nodes[1].ID())
+			if len(intervals) < 20 {
+				t.Fatalf("%d intervals in 30 periods, want about 30", len(intervals))
+			}
+			for _, interval := range intervals {
+				if interval < period/2 {
+					t.Fatalf("arrivals %v apart in intervals %v, want about %v", interval, intervals, period)
+				}
+			}
+		})
+	}
+}
+
+// the history follows the pace of the heartbeats, when the period changes or the heartbeats pause
+func TestPhiAccrualPace(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []time.Duration // between heartbeats
+		elapsed   time.Duration   // since the last heartbeat
+		suspected bool
+	}{
+		{"steady", repeatInterval(time.Second, 10), 500 * time.Millisecond, false},
+		{"steady and late", repeatInterval(time.Second, 10), 5 * time.Second, true},
+		{"longer period", append(repeatInterval(time.Second, 10), repeatInterval(20*time.Second, 5)...), 19 * time.Second, false},
+		{"shorter period", append(repeatInterval(20*time.Second, 10), repeatInterval(time.Second, 5)...), 5 * time.Second, false},
+		{"shorter period over the window", append(repeatInterval(20*time.Second, 10), repeatInterval(time.Second, PhiWindowSize)...), 5 * time.Second, true},
+		// a detector given two arrivals a round still builds up its history, and does not fall back to the timeout
+		{"two arrivals a round", alternateIntervals(20*time.Millisecond, 980*time.Millisecond, 15), 30 * time.Second, true},
+		{"pause", append(append(repeatInterval(time.Second, 10), time.Minute), repeatInterval(time.Second, 5)...), 5 * time.Second, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			detector := NewPhiAccrualDetector(PhiThreshold)
+			now := time.Unix(1000, 0)
+			detector.Heartbeat("member", now)
+			for _, interval := range test.intervals {
+				now = now.Add(interval)
+				detector.Heartbeat("member", now)
+			}
+			member := Member{ID: "member", Timestamp: now}
+			now = now.Add(test.elapsed)
+			if suspected := detector.Suspect(member, time.Hour, now); suspected != test.suspected {
+				t.Errorf("suspected %v with phi %.2f, want %v", suspected, detector.Phi("member", now), test.suspected)
+			}
+		})
+	}
+}
+
+func repeatInterval(interval time.Duration, count int) []time.Duration {
+	intervals := make([]time.Duration, count)
+	for i := range intervals {
+		intervals[i] = interval
+	}
+	return intervals
+}
+
+func alternateIntervals(short time.Duration, long time.Duration, rounds int) []time.Duration {
+	var intervals []time.Duration
+	for i := 0; i < rounds; i++ {
+		intervals = append(intervals, short, long)
+	}
+	return intervals
+}
+
+// number of samples in the history of a member
+func (d *PhiAccrualDetector) samples(id string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if history := d.histories[id]; history != nil {
+		return len(history.intervals)
+	}
+	return 0
+}
+
+// in all-to-all mode the phi detector builds up the history of every member from the heartbeats it receives,
+// and a crashed member is suspected by phi, sooner than by the fixed timeout
+func TestPhiAccrualAllToAll(t *testing.T) {
+	const size = 4
+	detectors := make([]*PhiAccrualDetector, size)
+	c := newSimCluster(t, size, 1, func(index int, config *Config) {
+		detectors[index] = NewPhiAccrualDetector(PhiThreshold)
+		config.FailureDetector = detectors[index]
+	})
+	c.joinAll()
+	c.waitFor("convergence", time.Minute, c.converged)
+	c.run(30 * time.Second)
+	for observer, detector := range detectors {
+		for member := range c.nodes {
+			if id := c.nodes[member].ID(); member != observer && detector.samples(id) < 20 {
+				t.Errorf("node%d has %d samples of node%d after 30 periods, want about 30", observer, detector.samples(id), member)
+			}
+		}
+	}
+
+	crashed := size - 1
+	id := c.nodes[crashed].ID()
+	c.nodes[crashed].Close()
+	suspicion := c.waitFor("suspicion", time.Minute, func() bool {
+		return c.status(0, crashed) != STAT_RUNNING
+	})
+	if phi := detectors[0].Phi(id, c.clock.Now()); phi <= PhiThreshold {
+		t.Errorf("phi of the crashed node is %.2f once suspected, want above %v", phi, PhiThreshold)
+	}
+	if timeout := DefaultParams().AllToAllTimeout; suspicion >= timeout {
+		t.Errorf("suspected in %v, want sooner than the fixed timeout of %v", suspicion, timeout)
+	}
+	c.waitFor("detection", time.Minute, func() bool {
+		return c.sees(indexes(0, crashed), []int{crashed}, STAT_FAILED)
+	})
+}
@@ -0,0 +1,69 @@
+// This file contains the optional encryption of messages with the cluster keys.
+// An encrypted message is:
+//
+//	magic | nonce | AES-256-GCM sealed message
+//
+// The AES key is derived from a key of the keyring. Messages are encrypted with the primary key,
+// and decrypted with any key. Nodes with and without encryption can't read each other,
+// their messages are dropped on both sides.
+package membership
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// first byte of every encrypted message
+const encryptMagic = 0xE5
+
+// size added to an encrypted message, magic and nonce, and the tag of GCM
+const encryptOverhead = 1 + 12 + 16
+
+// the label of the AES key derived from a cluster key
+var encryptKeyLabel = []byte("membership encryption key")
+
+// create the AEAD ciphers of all keys, the primary key first
+func newCiphers(keyring *Keyring) ([]cipher.AEAD, error) {
+	ciphers := make([]cipher.AEAD, 0, len(keyring.keys))
+	for _, key := range keyring.keys {
+		block, err := aes.NewCipher(computeMac(key, encryptKeyLabel))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		ciphers = append(ciphers, aead)
+	}
+	return ciphers, nil
+}
+
+// encrypt a message with the primary key
+func (a *authenticator) encrypt(message []byte) ([]byte, error) {
+	aead := a.ciphers[0]
+	encrypted := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(message)+aead.Overhead())
+	encrypted[0] = encryptMagic
+	if _, err := rand.Read(encrypted[1:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(encrypted, encrypted[1:], message, encrypted[:1]), nil
+}
+
+// decrypt a message with any key of the keyring
+func (a *authenticator) decrypt(encrypted []byte) ([]byte, error) {
+	if len(encrypted) < encryptOverhead || encrypted[0] != encryptMagic {
+		a.countFailure()
+		return nil, fmt.Errorf("%w: not encrypted", ErrAuthFailed)
+	}
+	for _, aead := range a.ciphers {
+		nonce, sealed := encrypted[1:1+aead.NonceSize()], encrypted[1+aead.NonceSize():]
+		if message, err := aead.Open(nil, nonce, sealed, encrypted[:1]); err == nil {
+			return message, nil
+		}
+	}
+	a.countFailure()
+	return nil, fmt.Errorf("%w: can't decrypt", ErrAuthFailed)
+}
@@ -0,0 +1,133 @@
+package membership
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// a node sealing and opening messages with the keys, without encryption if encrypt is not set,
+// and without signature if keys is empty
+func sealingNode(t *testing.T, clock Clock, encrypt bool, keys ...string) *Node {
+	t.Helper()
+	n := NewNode(Config{Addr: "self:2333", Clock: clock})
+	if len(keys) == 0 {
+		return n
+	}
+	var secondary [][]byte
+	for _, key := range keys[1:] {
+		secondary = append(secondary, []byte(key))
+	}
+	keyring, err := NewKeyring([]byte(keys[0]), secondary...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.auth, err = newAuthenticator(keyring, encrypt, clock); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+var sealedMessage = Message{Method: MSG_PING, SenderID: "127.0.0.1:2333-1633046400", SenderAddr: "127.0.0.1:2333", Payload: []byte("payload")}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	n := sealingNode(t, clock, true, "key")
+	sealed, err := n.sealMessage(sealedMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte(sealedMessage.SenderAddr)) || bytes.Contains(sealed, sealedMessage.Payload) {
+		t.Errorf("the sealed message is readable: %q", sealed)
+	}
+	if overhead := len(sealed) - len(mustEncode(t, n, sealedMessage)); overhead != n.sealOverhead() {
+		t.Errorf("sealing added %d bytes, want %d", overhead, n.sealOverhead())
+	}
+	opened, err := n.openMessage(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := n.codec.DecodeMessage(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Method != sealedMessage.Method || message.SenderID != sealedMessage.SenderID || !bytes.Equal(message.Payload, sealedMessage.Payload) {
+		t.Errorf("opened %+v, want %+v", message, sealedMessage)
+	}
+}
+
+func mustEncode(t *testing.T, n *Node, message Message) []byte {
+	t.Helper()
+	data, err := n.codec.EncodeMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// a message with any byte changed is dropped, whether in the magic, the nonce, the ciphertext or the tag
+func TestEncryptFlippedByte(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	n := sealingNode(t, clock, true, "key")
+	sealed, err := n.sealMessage(sealedMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int{0, 1, 13, len(sealed) / 2, len(sealed) - 1} {
+		flipped := append([]byte(nil), sealed...)
+		flipped[index] ^= 0x01
+		if _, err := n.openMessage(flipped); !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("byte %d flipped: got %v, want %v", index, err, ErrAuthFailed)
+		}
+	}
+	if failures, _ := n.auth.stats(); failures != 5 {
+		t.Errorf("%d failures counted, want 5", failures)
+	}
+}
+
+// which nodes can read each other, while the key is rotated and with and without encryption
+func TestEncryptKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		sender   []string // keys of the sender, the primary key first
+		encrypt  [2]bool  // whether the sender and the receiver encrypt
+		receiver []string
+		opened   bool
+	}{
+		{"same key", []string{"old"}, [2]bool{true, true}, []string{"old"}, true},
+		{"other key", []string{"old"}, [2]bool{true, true}, []string{"new"}, false},
+		{"old primary as secondary", []string{"old"}, [2]bool{true, true}, []string{"new", "old"}, true},
+		{"new primary unknown", []string{"new", "old"}, [2]bool{true, true}, []string{"old"}, false},
+		{"encrypted to signed", []string{"key"}, [2]bool{true, false}, []string{"key"}, false},
+		{"signed to encrypted", []string{"key"}, [2]bool{false, true}, []string{"key"}, false},
+		{"encrypted to plaintext", []string{"key"}, [2]bool{true, false}, nil, false},
+		{"plaintext to encrypted", nil, [2]bool{false, true}, []string{"key"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1000, 0))
+			sender := sealingNode(t, clock, test.encrypt[0], test.sender...)
+			receiver := sealingNode(t, clock, test.encrypt[1], test.receiver...)
+			sealed, err := sender.sealMessage(sealedMessage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opened, err := receiver.openMessage(sealed)
+			if test.opened && err != nil {
+				t.Fatalf("the message is dropped: %v", err)
+			}
+			if !test.opened {
+				// without a keyring the receiver takes the sealed bytes as they are, and can't decode them
+				if err == nil && receiver.auth == nil {
+					_, err = receiver.codec.DecodeMessage(opened)
+				} else if !errors.Is(err, ErrAuthFailed) {
+					t.Errorf("got %v, want %v", err, ErrAuthFailed)
+				}
+				if err == nil {
+					t.Error("the message is opened")
+				}
+			}
+		})
+	}
+}
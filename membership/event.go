@@ -0,0 +1,117 @@
+// This file contains the membership change events.
+// Every change of the member list is published to all subscribers in order.
+// Each subscriber has its own queue and goroutine, so a slow subscriber
+// never blocks the member list or the other subscribers.
+package membership
+
+import (
+	"sync"
+)
+
+// kind of a membership change
+type EventKind string
+
+const (
+	EVENT_JOIN    EventKind = "Join"    // a member is added, or is running again after failed or left
+	EVENT_UPDATE  EventKind = "Update"  // address or incarnation of a member changed, or it is no longer suspected
+	EVENT_SUSPECT EventKind = "Suspect" // a member is suspected
+	EVENT_FAIL    EventKind = "Fail"    // a member is confirmed failed
+	EVENT_LEAVE   EventKind = "Leave"   // a member left
+	EVENT_REMOVE  EventKind = "Remove"  // a failed or left member is removed from the member list
+	// a failed or removed member is found alive on the other side of a partition, see heal.go
+	EVENT_PARTITION_HEALED EventKind = "PartitionHealed"
+)
+
+// MemberEvent is a change of a member
+type MemberEvent struct {
+	Kind   EventKind
+	Member Member // the member after the change
+}
+
+// publish events to subscribers
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers []*subscriber
+	closed      bool
+}
+
+// a subscriber with its pending events
+type subscriber struct {
+	mu     sync.Mutex
+	queue  []MemberEvent
+	notify chan struct{} // signaled when queue is appended
+	stop   chan struct{} // closed when the hub is closed
+	out    chan MemberEvent
+}
+
+// add a subscriber, the channel is closed when the hub is closed
+func (h *eventHub) subscribe() <-chan MemberEvent {
+	s := &subscriber{
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		out:    make(chan MemberEvent),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.out)
+		return s.out
+	}
+	h.subscribers = append(h.subscribers, s)
+	go s.deliver()
+	return s.out
+}
+
+// queue an event for all subscribers, it never blocks on a subscriber
+func (h *eventHub) publish(event MemberEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.subscribers {
+		s.mu.Lock()
+		s.queue = append(s.queue, event)
+		s.mu.Unlock()
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// close all subscriptions, pending events are dropped
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for _, s := range h.subscribers {
+		close(s.stop)
+	}
+	h.subscribers = nil
+}
+
+// deliver queued events in order until the hub is closed
+func (s *subscriber) deliver() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.notify:
+				continue
+			case <-s.stop:
+				return
+			}
+		}
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.out <- event:
+		case <-s.stop:
+			return
+		}
+	}
+}
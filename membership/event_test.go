@@ -0,0 +1,90 @@
+package membership
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// read the events of the member from the subscription until the kind arrives, other kinds but updates are kept in order
+func eventsUntil(t *testing.T, events <-chan MemberEvent, id string, last EventKind) []EventKind {
+	t.Helper()
+	var kinds []EventKind
+	for {
+		select {
+		case event := <-events:
+			if event.Member.ID != id || event.Kind == EVENT_UPDATE {
+				continue
+			}
+			kinds = append(kinds, event.Kind)
+			if event.Kind == last {
+				return kinds
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event of %s, got %v", last, id, kinds)
+		}
+	}
+}
+
+// subscribers are never read while a member joins, crashes and is removed:
+// the protocol goes on, and the events of the member are delivered in order once read
+func TestEventOrderSlowSubscriber(t *testing.T) {
+	c := newSimCluster(t, 3, 1, func(index int, config *Config) {
+		config.Params.CleanUp = 3 * time.Second
+	})
+	c.nodes[0].Subscribe() // never read
+	late := c.nodes[0].Subscribe()
+	c.joinAll()
+	c.waitFor("convergence", time.Minute, c.converged)
+
+	crashed := 2
+	id := c.nodes[crashed].ID()
+	c.nodes[crashed].Close()
+	c.waitFor("removal", time.Minute, func() bool {
+		_, ok := c.nodes[0].members.getMemberById(id)
+		return !ok
+	})
+
+	want := []EventKind{EVENT_JOIN, EVENT_SUSPECT, EVENT_FAIL, EVENT_REMOVE}
+	if kinds := eventsUntil(t, late, id, EVENT_REMOVE); fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("events of the crashed member are %v, want %v", kinds, want)
+	}
+}
+
+// a subscriber never read does not block the member list, however many changes are queued
+func TestEventUnreadSubscriber(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	list := NewMemberList(Member{ID: "self", Addr: "self:2333", Status: STAT_RUNNING}, NewTimeoutDetector(), clock)
+	defer list.Close()
+	list.Subscribe() // never read
+	late := list.Subscribe()
+
+	const changes = 10000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < changes; i++ {
+			// a new address is an update of the member
+			list.heartbeatFromMember("member", fmt.Sprintf("member:%d", i), false)
+		}
+		list.suspectMember("member")
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the member list is blocked by its subscribers")
+	}
+
+	// the queued events of the member come in order, the first update after the join is from the second address
+	for i := 0; i <= changes; i++ {
+		event := <-late
+		switch {
+		case i == 0 && event.Kind != EVENT_JOIN:
+			t.Fatalf("first event is %s, want %s", event.Kind, EVENT_JOIN)
+		case i > 0 && i < changes && event.Member.Addr != fmt.Sprintf("member:%d", i):
+			t.Fatalf("event %d is %s at %s, want an update at member:%d", i, event.Kind, event.Member.Addr, i)
+		case i == changes && event.Kind != EVENT_SUSPECT:
+			t.Fatalf("last event is %s, want %s", event.Kind, EVENT_SUSPECT)
+		}
+	}
+}
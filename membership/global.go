@@ -0,0 +1,58 @@
+// This file contains global constants and loggers.
+package membership
+
+import (
+	"log"
+	"os"
+)
+
+// some const parameters, the ones in Params are only defaults and can be changed while running, see params.go
+const (
+	MaxBufferSize = 4096 // max size of buffers
+	SleepPeriod   = 50   // period of sleep when there is no task to do
+	// time a resolved address is cached in seconds
+	AddrCacheSeconds = 300
+	// failure related:
+	GossipTimeOutSeconds   = 10   // max timeouts in seconds
+	AllToAllTimeOutSeconds = 5    // max timeouts in seconds
+	SuspicionSeconds       = 5    // default time a member stays suspected before it is failed
+	CleanUpSeconds         = 600  // time for cleaning up failed processes in seconds
+	HeartbeatPeriod        = 1000 // period of sending out ping in milliseconds
+	// gossip related
+	GossipRate   = 5    // how many times a gossip would be transferred to
+	GossipBudget = 1400 // max size of a gossip datagram in bytes, to fit in the MTU
+	// rounds of gossip for an entry to spread to all members, as a multiple of log2 of the group size
+	PropagationMultiplier = 4
+	// push/pull related
+	PushPullPeriod  = 30      // period of full state sync over TCP in seconds
+	PushPullTimeout = 5       // timeout of a full state sync in seconds
+	MaxPushPullSize = 4 << 20 // max size of a full state message in bytes
+	// join related
+	JoinRetryMin   = 1000  // backoff after the first round of failed join attempts in milliseconds
+	JoinRetryMax   = 30000 // max backoff between rounds of join attempts in milliseconds
+	JoinAckTimeout = 1000  // time to wait for a join ack without full state sync in milliseconds
+	// heal related
+	HealPeriod = 5000 // period of contacting failed members and seeds in milliseconds
+	// leave related
+	LeaveRounds      = 4   // max rounds of sending leave to members which have not acked
+	LeaveRoundPeriod = 500 // time between rounds of leave in milliseconds
+	// metadata related
+	MaxMetaEntries = 16  // max number of metadata entries of a member
+	MaxMetaSize    = 512 // max total size of metadata keys and values in bytes
+	// auth related
+	AuthWindowSeconds = 30 // max clock skew of a signed message, older nonces are forgotten
+	// swim related
+	SwimProbeTimeout   = 400 // time to wait for a direct ack in milliseconds
+	SwimIndirectProbes = 3   // how many members are asked to probe indirectly
+	// health related
+	MaxHealthScore = 8 // max local health score, timeouts are scaled by up to MaxHealthScore + 1 times
+	MinHealthPings = 3 // min running members pinged in an all-to-all round for missed acks to raise the score
+)
+
+// loggers
+var (
+	InfoLogger  = log.New(os.Stdout, "[info ]", log.Ltime)
+	DebugLogger = log.New(os.Stderr, "[debug]", log.Ltime)
+	WarnLogger  = log.New(os.Stderr, "[warn ]", log.Ltime)
+	ErrorLogger = log.New(os.Stderr, "[error]", log.Ltime)
+)
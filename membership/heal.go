@@ -0,0 +1,169 @@
+// This file contains the healing of partitions.
+// When the network splits, each side confirms the members of the other side failed,
+// and may remove them later, so heartbeats and gossip never cross the split again.
+// In background, a node keeps contacting failed members, members removed as failed,
+// and seeds which are not in its member list, with a heal carrying its member list.
+// The heal puts the entry the sender holds of the receiver right after the sender itself,
+// so the receiver finds itself dead in the view of the sender, and refutes with a new incarnation.
+// The heal ack does the same the other way, and the two views are merged by incarnation and status.
+// Members of either side are revived in the same way by later heals and by gossip.
+package membership
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// remember the seeds to heal through, the caller holds the lock
+func (n *Node) addSeeds(seeds ...string) {
+	for _, seed := range seeds {
+		known := seed == n.addr
+		for _, old := range n.seeds {
+			known = known || old == seed
+		}
+		if !known {
+			n.seeds = append(n.seeds, seed)
+		}
+	}
+}
+
+// periodically contact members on the other side of a partition
+func (n *Node) runHeal(ctx context.Context) {
+	defer n.wg.Done()
+	ticker := n.clock.NewTicker(HealPeriod * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		n.mu.Lock()
+		// a joining node is healed by its join
+		if ctx.Err() == nil && !n.left && n.cancelJoin == nil {
+			for _, target := range n.healTargets(n.params.GossipRate) {
+				n.sendHeal(target)
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+// return at most requiredSize random addresses of failed members, members removed as failed,
+// and seeds no active member listens on. The caller holds the lock.
+func (n *Node) healTargets(requiredSize int) []string {
+	active := map[string]bool{n.addr: true}
+	var targets []string
+	for _, member := range n.members.Snapshot() {
+		if member.ID == n.id {
+			continue
+		}
+		if isActive(member) {
+			active[member.Addr] = true
+		} else if member.Status == STAT_FAILED {
+			targets = append(targets, member.Addr)
+		}
+	}
+	for _, member := range n.members.buriedMembers() {
+		if member.Status == STAT_FAILED {
+			targets = append(targets, member.Addr)
+		}
+	}
+	targets = append(targets, n.seeds...)
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+
+	resultList := make([]string, 0, requiredSize)
+	for _, addr := range targets {
+		if len(resultList) == requiredSize {
+			break
+		}
+		// a member of the same address may have rejoined with another id
+		if !active[addr] {
+			active[addr] = true
+			resultList = append(resultList, addr)
+		}
+	}
+	return resultList
+}
+
+// send a heal to the address, with the dead entries of members on it. The caller holds the lock.
+func (n *Node) sendHeal(addr string) {
+	heal := Message{Method: MSG_HEAL}
+	heal.Payload = n.membersPayload(heal, n.params.MaxBufferSize, n.members.deadEntries(addr)...)
+	n.sendMessage(heal, addr)
+}
+
+// handle heal message, merge the member list of the sender and reply with the local one
+func (n *Node) handleHealMessage(message Message) {
+	memberList, err := n.codec.DecodeMembers(message.Payload)
+	if err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	// the dead entry of the sender is taken before the merge, so that the sender refutes it
+	dead := n.members.deadEntries(message.SenderAddr)
+	n.mergeHeal(message, memberList)
+	ack := Message{Method: MSG_HEAL_ACK}
+	ack.Payload = n.membersPayload(ack, n.params.MaxBufferSize, dead...)
+	n.sendMessage(ack, message.SenderAddr)
+}
+
+// handle heal ack message, merge the member list of the sender.
+// If the sender thinks this node is dead, heal again with the refuted entry.
+func (n *Node) handleHealAckMessage(message Message) {
+	memberList, err := n.codec.DecodeMembers(message.Payload)
+	if err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	n.mergeHeal(message, memberList)
+	for _, member := range memberList {
+		if member.ID == n.id && member.Status != STAT_RUNNING {
+			n.sendHeal(message.SenderAddr)
+			return
+		}
+	}
+}
+
+// merge the member list of a heal, and tell subscribers if the sender is back
+func (n *Node) mergeHeal(message Message, memberList []Member) {
+	old, known := n.members.getMemberById(message.SenderID)
+	n.members.mergeGossipMemberList(memberList, n.mode != MODE_ALL_TO_ALL)
+	if known && isActive(old) {
+		return
+	}
+	if member, ok := n.members.getMemberById(message.SenderID); ok && isActive(member) {
+		InfoLogger.Println("Partition healed with", member.ID, "at", member.Addr, ".")
+		n.members.notify(EVENT_PARTITION_HEALED, member)
+	}
+}
+
+// entries of members on the address which are failed, left or removed
+func (l *MemberList) deadEntries(addr string) []Member {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var entries []Member
+	for _, member := range l.members {
+		if member.Addr == addr && member.ID != l.selfID && !isActive(member) {
+			entries = append(entries, member)
+		}
+	}
+	for _, tomb := range l.tombstones {
+		if tomb.member.Addr == addr {
+			entries = append(entries, tomb.member)
+		}
+	}
+	return entries
+}
+
+// the last entries of removed or unknown dead members
+func (l *MemberList) buriedMembers() []Member {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	members := make([]Member, 0, len(l.tombstones))
+	for _, tomb := range l.tombstones {
+		members = append(members, tomb.member)
+	}
+	return members
+}
@@ -0,0 +1,121 @@
+package membership
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// nodes told by EVENT_PARTITION_HEALED that a member of the other side is back
+type healedNodes struct {
+	mu     sync.Mutex
+	healed map[int]bool
+}
+
+// subscribe to the events of all nodes, a node is healed once it is told about a member of the other side
+func watchHealed(c *simCluster, side func(index int) int) *healedNodes {
+	watched := &healedNodes{healed: make(map[int]bool)}
+	ids := make(map[string]int)
+	for index, node := range c.nodes {
+		ids[node.ID()] = index
+	}
+	for index, node := range c.nodes {
+		go func(index int, events <-chan MemberEvent) {
+			for event := range events {
+				if other, ok := ids[event.Member.ID]; ok && event.Kind == EVENT_PARTITION_HEALED && side(other) != side(index) {
+					watched.mu.Lock()
+					watched.healed[index] = true
+					watched.mu.Unlock()
+				}
+			}
+		}(index, node.Subscribe())
+	}
+	return watched
+}
+
+// whether some of the nodes have been told the partition healed
+func (h *healedNodes) any(nodes []int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, index := range nodes {
+		if h.healed[index] {
+			return true
+		}
+	}
+	return false
+}
+
+// two halves of a group are split until each sees the other failed or removed,
+// then the network heals and heals bring both halves back together
+func TestHealPartition(t *testing.T) {
+	tests := []struct {
+		mode    string
+		removed bool // the other half is removed from the member lists before the heal
+	}{
+		{MODE_ALL_TO_ALL, false},
+		{MODE_ALL_TO_ALL, true},
+		{MODE_GOSSIP, false},
+		{MODE_GOSSIP, true},
+		{MODE_SWIM, false},
+		{MODE_SWIM, true},
+	}
+	for _, test := range tests {
+		test := test
+		name := test.mode + "/failed"
+		if test.removed {
+			name = test.mode + "/removed"
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			const size = 8
+			c := newSimCluster(t, size, 7, func(index int, config *Config) {
+				config.Mode = test.mode
+				if test.removed {
+					config.Params.CleanUp = 3 * time.Second
+				}
+			})
+			left, right := indexes(0, size/2), indexes(size/2, size)
+			side := func(index int) int { return index * 2 / size }
+			healed := watchHealed(c, side)
+			c.network.SetLossRate(0.05)
+			c.joinAll()
+			c.waitFor("convergence", time.Minute, c.converged)
+
+			var leftAddrs, rightAddrs []string
+			for _, index := range left {
+				leftAddrs = append(leftAddrs, simAddr(index))
+			}
+			for _, index := range right {
+				rightAddrs = append(rightAddrs, simAddr(index))
+			}
+			c.network.Partition(leftAddrs, rightAddrs)
+			c.waitFor("split", 5*time.Minute, func() bool {
+				for index, node := range c.nodes {
+					same, other := left, right
+					if side(index) == 1 {
+						same, other = right, left
+					}
+					if !c.sees([]int{index}, same, STAT_RUNNING) {
+						return false
+					}
+					if test.removed && node.members.Len() != len(same) {
+						return false
+					}
+					if !test.removed && !c.sees([]int{index}, other, STAT_FAILED) {
+						return false
+					}
+				}
+				return true
+			})
+			if healed.any(c.all()) {
+				t.Fatal("partition healed before the network healed")
+			}
+
+			c.network.Heal()
+			c.waitFor("heal", 5*time.Minute, func() bool {
+				// a side may only learn the other is back by gossip from a member which healed, without the event
+				return c.converged() && healed.any(c.all())
+			})
+		})
+	}
+}
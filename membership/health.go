@@ -0,0 +1,76 @@
+// This file contains the local health of a node, in the way of Lifeguard.
+// A slow node, paused or too busy to read its messages in time, misses the acks of healthy members
+// and suspects them, while the fault is its own. So a node scores its own health:
+// the score rises when it misses acks and when others suspect it, and drops when acks come back in time.
+// Timeouts of probes, heartbeats and suspicions are scaled by the score plus one,
+// so an unhealthy node waits longer before it suspects others or confirms their failure.
+package membership
+
+import (
+	"sync"
+	"time"
+)
+
+// local health score, a nil health is always healthy
+type health struct {
+	mu    sync.Mutex
+	score int // from 0, healthy, to MaxHealthScore
+}
+
+// change the score by delta, within 0 and MaxHealthScore
+func (h *health) apply(delta int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.score += delta
+	if h.score < 0 {
+		h.score = 0
+	}
+	if h.score > MaxHealthScore {
+		h.score = MaxHealthScore
+	}
+}
+
+func (h *health) get() int {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.score
+}
+
+// the multiplier of timeouts, the score plus one
+func (h *health) multiplier() int {
+	return h.get() + 1
+}
+
+// scale a timeout by the multiplier
+func (h *health) scale(timeout time.Duration) time.Duration {
+	return timeout * time.Duration(h.multiplier())
+}
+
+// HealthScore returns the local health score of the node, 0 is healthy, timeouts are scaled by the score plus one
+func (n *Node) HealthScore() int {
+	return n.health.get()
+}
+
+// an all-to-all round ends, the score rises if nearly all pings of the round are not acked, and drops otherwise.
+// Only running members are counted, a suspected member missing its ack tells nothing about the local node.
+// A crash of the only other member, or a partition of half of the group, is not taken as a slow local node:
+// the score only rises if at least MinHealthPings members were pinged and more than three quarters missed.
+// The caller holds the lock.
+func (n *Node) finishPingRound() {
+	if n.pendingPongs == nil {
+		return
+	}
+	if n.pingedMembers >= MinHealthPings && 4*len(n.pendingPongs) > 3*n.pingedMembers {
+		n.health.apply(1)
+	} else {
+		n.health.apply(-1)
+	}
+	n.pendingPongs = nil
+	n.pingedMembers = 0
+}
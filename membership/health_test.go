@@ -0,0 +1,65 @@
+package membership
+
+import (
+	"testing"
+	"time"
+)
+
+// a crashed or partitioned member is down, the local node is not slow:
+// the local health score stays low and the failure is detected as fast as by a healthy node
+func TestHealthDown(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		size         int
+		partition    bool // half of the group is split away, otherwise the last node crashes
+		maxScore     int
+		maxDetection time.Duration
+	}{
+		{"crash of the only other member", MODE_ALL_TO_ALL, 2, false, 0, 12 * time.Second},
+		{"crash of the only other member", MODE_SWIM, 2, false, 0, 12 * time.Second},
+		{"partition of half", MODE_ALL_TO_ALL, 8, true, 1, 12 * time.Second},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.mode+"/"+test.name, func(t *testing.T) {
+			t.Parallel()
+			c := newSimCluster(t, test.size, 1, func(index int, config *Config) {
+				config.Mode = test.mode
+			})
+			c.joinAll()
+			c.waitFor("convergence", time.Minute, c.converged)
+
+			observers, down := indexes(0, test.size/2), indexes(test.size/2, test.size)
+			if test.partition {
+				var left, right []string
+				for _, index := range observers {
+					left = append(left, simAddr(index))
+				}
+				for _, index := range down {
+					right = append(right, simAddr(index))
+				}
+				c.network.Partition(left, right)
+			} else {
+				observers, down = indexes(0, test.size-1), []int{test.size - 1}
+				c.nodes[test.size-1].Close()
+			}
+			maxScore := 0
+			detection := c.waitFor("detection", 2*time.Minute, func() bool {
+				for _, index := range observers {
+					if score := c.nodes[index].HealthScore(); score > maxScore {
+						maxScore = score
+					}
+				}
+				return c.sees(observers, down, STAT_FAILED)
+			})
+			t.Logf("detected in %v, max health score %d", detection, maxScore)
+			if maxScore > test.maxScore {
+				t.Errorf("health score rose to %d, want at most %d", maxScore, test.maxScore)
+			}
+			if detection > test.maxDetection {
+				t.Errorf("detected in %v, want at most %v", detection, test.maxDetection)
+			}
+		})
+	}
+}
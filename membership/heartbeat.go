@@ -0,0 +1,301 @@
+// This file includes functions for heartbeating style of failure detection.
+// Three variants:
+//  1. All to All heartbeating
+//  2. Gossip heartbeating: Push-based Gossip
+//  3. SWIM: randomized probing with indirect ping-req, see swim.go
+package membership
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// heartbeat modes
+const (
+	MODE_ALL_TO_ALL = "all-to-all"
+	MODE_GOSSIP     = "gossip"
+	MODE_SWIM       = "swim"
+)
+
+// whether the mode is a known heartbeat mode
+func isValidMode(mode string) bool {
+	return mode == MODE_ALL_TO_ALL || mode == MODE_GOSSIP || mode == MODE_SWIM
+}
+
+// the mode to switch to, toggle between all-to-all and gossip if no valid target is given
+func nextMode(current string, target string) string {
+	if isValidMode(target) {
+		return target
+	}
+	if current == MODE_ALL_TO_ALL {
+		return MODE_GOSSIP
+	}
+	return MODE_ALL_TO_ALL
+}
+
+// whether the mode of the epoch is newer than the current one
+func (n *Node) isNewerMode(mode string, epoch int) bool {
+	if !isValidMode(mode) {
+		return false
+	}
+	if epoch != n.modeEpoch {
+		return epoch > n.modeEpoch
+	}
+	// concurrent switches of the same epoch, the larger mode wins
+	// the initial mode of epoch 0 is only taken from the seed when joining
+	return epoch > 0 && mode > n.mode
+}
+
+// switch to the heartbeat mode of the epoch
+func (n *Node) adoptMode(mode string, epoch int) {
+	n.modeEpoch = epoch
+	if mode != n.mode {
+		n.setMode(mode)
+	}
+	InfoLogger.Println("Process", n.id, "has changed to", n.mode, "style at epoch", epoch, ".")
+}
+
+// take the mode of a message if it is newer, so that a switch spreads with every message
+func (n *Node) observeMode(message Message) {
+	if n.isNewerMode(message.Mode, message.ModeEpoch) {
+		n.adoptMode(message.Mode, message.ModeEpoch)
+	}
+}
+
+// change the heartbeat mode, and drop the state of previous mode
+func (n *Node) setMode(mode string) {
+	n.mode = mode
+	n.probe = nil
+	n.probeOrder = nil
+	n.pendingPongs = nil
+	// empty other member's heartbeat, counters of different modes are not comparable
+	n.members.resetHeartbeats()
+}
+
+// check whether any process failed
+func (n *Node) checkFailure() {
+	n.members.pruneTombstones(n.tombstoneTimeout())
+	// check timeout(failure) of all members
+	for _, member := range n.members.Snapshot() {
+		if member.ID == n.id {
+			continue
+		}
+		// otherwise, check time span between now and the last status change or heartbeat
+		now := n.clock.Now()
+		timeSpan := now.Sub(member.Timestamp)
+		switch member.Status {
+		case STAT_FAILED, STAT_LEFT: // check failed process and clean up
+			if timeSpan > n.params.CleanUp {
+				n.members.removeMember(member)
+			}
+		case STAT_SUSPECT: // confirm the failure if the suspicion is not refuted in time
+			if timeSpan > n.health.scale(n.config.SuspicionTimeout) {
+				n.members.failMember(member.ID)
+			}
+		default:
+			timeout := n.params.AllToAllTimeout
+			if n.mode != MODE_ALL_TO_ALL {
+				// in swim mode, members not probed by us are renewed through piggybacked gossip
+				timeout = n.params.GossipTimeout
+			}
+			// an unhealthy node may have missed the heartbeats itself
+			if n.detector.Suspect(member, n.health.scale(timeout), now) {
+				n.members.suspectMember(member.ID)
+			}
+		}
+	}
+}
+
+// periodically send out heartbeat
+func (n *Node) runHeartBeat(ctx context.Context) {
+	defer n.wg.Done()
+	// set ticker to heartbeat periodically
+	n.mu.Lock()
+	period := n.params.HeartbeatPeriod
+	n.mu.Unlock()
+	ticker := n.clock.NewTicker(period)
+	defer func() { ticker.Stop() }()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		n.mu.Lock()
+		// the socket may be closed while waiting for the lock
+		if ctx.Err() == nil && !n.left {
+			n.metrics.observeHeartbeat(n.clock.Now(), period)
+			switch n.mode {
+			case MODE_GOSSIP:
+				n.gossipHeartBeat()
+			case MODE_SWIM:
+				n.swimHeartBeat()
+			default:
+				n.allToAllHeartBeat()
+			}
+		} else {
+			n.metrics.resetHeartbeat()
+		}
+		// restart the ticker if the period is changed
+		if n.params.HeartbeatPeriod != period {
+			period = n.params.HeartbeatPeriod
+			ticker.Stop()
+			ticker = n.clock.NewTicker(period)
+			n.metrics.resetHeartbeat()
+		}
+		n.mu.Unlock()
+	}
+}
+
+// broadcast heartbeat to all peers
+func (n *Node) allToAllHeartBeat() {
+	// the pings of previous round are acked by now
+	n.finishPingRound()
+	var members []Member
+	for _, member := range n.members.Snapshot() {
+		if n.isValidRemoteMember(member) {
+			members = append(members, member)
+		}
+	}
+	if len(members) == 0 {
+		return
+	}
+	// suspected members are pinged as well, but their acks are not counted by the local health
+	n.pendingPongs = make(map[string]bool, len(members))
+	n.pingedMembers = 0
+	for _, member := range members {
+		if member.Status == STAT_RUNNING {
+			n.pendingPongs[member.ID] = true
+			n.pingedMembers++
+		}
+	}
+	// send PING message to all RUNNING process
+	n.broadcastMessage(Message{Method: MSG_PING}, members...)
+}
+
+// GossipMode style heartbeat, send member list
+func (n *Node) gossipHeartBeat() {
+	n.members.incrementHeartbeat(n.id)
+	// send GOSSIP message to completely random processes
+	members := n.getRandomMembers(n.params.GossipRate)
+	if len(members) == 0 {
+		return
+	}
+	n.broadcastMessage(Message{Method: MSG_PING, Payload: n.gossipPayload(MSG_PING)}, members...)
+}
+
+// serialize the part of member list that fits into one datagram of GossipBudget bytes,
+// itself first and then the most recently changed members
+func (n *Node) gossipPayload(method string) []byte {
+	return n.membersPayload(Message{Method: method}, GossipBudget)
+}
+
+// serialize the part of member list that fits into the message within budget bytes,
+// itself first, then the given entries which replace the local ones, and then the most recently changed members
+func (n *Node) membersPayload(message Message, budget int, first ...Member) []byte {
+	payload, _ := n.fitMembers(message, budget, n.payloadCandidates(first...))
+	return payload
+}
+
+// serialize the whole member list into as many payloads of the message as needed, each within budget bytes
+func (n *Node) membersPages(message Message, budget int) [][]byte {
+	var pages [][]byte
+	for candidates := n.payloadCandidates(); len(candidates) > 0; {
+		payload, rest := n.fitMembers(message, budget, candidates)
+		if len(rest) == len(candidates) {
+			ErrorLogger.Println(len(rest), "members do not fit into a message of", budget, "bytes")
+			break
+		}
+		pages = append(pages, payload)
+		candidates = rest
+	}
+	return pages
+}
+
+// all members in the order they are serialized,
+// itself first, then the given entries which replace the local ones, and then the most recently changed members
+func (n *Node) payloadCandidates(first ...Member) []Member {
+	given := make(map[string]bool, len(first))
+	candidates := append([]Member(nil), first...)
+	for _, member := range first {
+		given[member.ID] = true
+	}
+	for _, member := range n.members.Snapshot() {
+		if !given[member.ID] {
+			candidates = append(candidates, member)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	order := func(member Member) int {
+		switch {
+		case member.ID == n.id:
+			return 0
+		case given[member.ID]:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if order(candidates[i]) != order(candidates[j]) {
+			return order(candidates[i]) < order(candidates[j])
+		}
+		return candidates[i].Changed.After(candidates[j].Changed)
+	})
+	return candidates
+}
+
+// serialize the candidates that fit into the message within budget bytes, in their order,
+// and return the candidates left out
+func (n *Node) fitMembers(message Message, budget int, candidates []Member) ([]byte, []Member) {
+	message = n.stampMessage(message)
+	budget -= n.sealOverhead()
+
+	// estimate the size of each entry and take as many as the budget allows
+	emptyMessage, err := n.codec.EncodeMessage(message)
+	if err != nil {
+		ErrorLogger.Println("Encode error:", err)
+		return nil, candidates
+	}
+	size := len(emptyMessage)
+	selected := make([]Member, 0, len(candidates))
+	var rest []Member
+	for _, member := range candidates {
+		memberBytes, err := n.codec.EncodeMembers([]Member{member})
+		if err != nil {
+			ErrorLogger.Println("Encode error:", err)
+			continue
+		}
+		if size+len(memberBytes) > budget {
+			rest = append(rest, member)
+			continue
+		}
+		size += len(memberBytes)
+		selected = append(selected, member)
+	}
+
+	// the estimation ignores the overhead of the payload in the message, shrink until it fits
+	for {
+		payload, err := n.codec.EncodeMembers(selected)
+		if err != nil {
+			ErrorLogger.Println("Encode error:", err)
+			return nil, candidates
+		}
+		message.Payload = payload
+		messageBytes, err := n.codec.EncodeMessage(message)
+		if err != nil {
+			ErrorLogger.Println("Encode error:", err)
+			return nil, candidates
+		}
+		if len(messageBytes) <= budget || len(selected) <= 1 {
+			return payload, rest
+		}
+		keep := len(selected) * budget / len(messageBytes)
+		if keep >= len(selected) {
+			keep = len(selected) - 1
+		}
+		rest = append(append([]Member(nil), selected[keep:]...), rest...)
+		selected = selected[:keep]
+	}
+}
@@ -0,0 +1,48 @@
+package membership
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// a suspicion older than the heartbeats of all other members is still gossiped,
+// so that it can be refuted before it is confirmed
+func TestMembersPayloadChangedFirst(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	n := NewNode(Config{Addr: "self:2333", Clock: clock})
+	for i := 0; i < 200; i++ {
+		n.members.heartbeatFromMember(fmt.Sprintf("member%d", i), fmt.Sprintf("member%d:2333", i), false)
+	}
+	clock.Advance(time.Second)
+	n.members.suspectMember("member42")
+	for round := 0; round < 3; round++ {
+		clock.Advance(time.Second)
+		for i := 0; i < 200; i++ {
+			if i != 42 {
+				n.members.heartbeatFromMember(fmt.Sprintf("member%d", i), fmt.Sprintf("member%d:2333", i), false)
+			}
+		}
+	}
+
+	payload := n.gossipPayload(MSG_PING)
+	members, err := n.codec.DecodeMembers(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) >= n.members.Len() {
+		t.Fatalf("all %d members fit in the budget, the list is too small for the test", len(members))
+	}
+	if members[0].ID != n.ID() {
+		t.Errorf("first entry is %s, want the local member", members[0].ID)
+	}
+	for _, member := range members {
+		if member.ID == "member42" {
+			if member.Status != STAT_SUSPECT {
+				t.Errorf("member42 is %s, want %s", member.Status, STAT_SUSPECT)
+			}
+			return
+		}
+	}
+	t.Errorf("the suspected member is not among the %d gossiped entries", len(members))
+}
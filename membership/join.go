@@ -0,0 +1,220 @@
+// This file contains the join of a node.
+// A node joins through a list of seeds, and any running member can be a seed.
+// The seeds are tried in turn, and after each round the node backs off,
+// until the full member list is received from one of them,
+// either in a join ack or through a full state sync.
+// A member list larger than a datagram is acked in several pages,
+// and the join only succeeds once all pages of the same ack are received.
+// Pages of two acks may split the list differently, so they are never mixed.
+package membership
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// max size of the page header of a join ack
+const joinAckHeaderSize = 3 * binary.MaxVarintLen64
+
+// a page of a join ack
+type joinAckPage struct {
+	ack   int // number of the ack, counted by the seed
+	page  int // index of the page
+	pages int // number of pages of the ack
+}
+
+// pages of a join ack received from a seed
+type joinAckPages struct {
+	ack      int
+	received []bool
+}
+
+// prefix a page of the member list with its header
+func encodeJoinAck(header joinAckPage, members []byte) []byte {
+	payload := appendUvarint(nil, uint64(header.ack))
+	payload = appendUvarint(payload, uint64(header.page))
+	payload = appendUvarint(payload, uint64(header.pages))
+	return append(payload, members...)
+}
+
+// split a join ack into its header and the member list
+func decodeJoinAck(payload []byte) (joinAckPage, []byte, error) {
+	reader := binaryReader{data: payload}
+	ack := reader.readUvarint()
+	page := reader.readUvarint()
+	pages := reader.readUvarint()
+	if reader.err != nil {
+		return joinAckPage{}, nil, reader.err
+	}
+	if page >= pages {
+		return joinAckPage{}, nil, fmt.Errorf("invalid page %d of %d", page, pages)
+	}
+	return joinAckPage{ack: int(ack), page: int(page), pages: int(pages)}, reader.data, nil
+}
+
+// send the whole member list to the new member, in as many join acks as needed. The caller holds the lock.
+func (n *Node) sendJoinAcks(addr string) {
+	ack := Message{Method: MSG_JOIN_ACK}
+	pages := n.membersPages(ack, n.params.MaxBufferSize-joinAckHeaderSize)
+	n.joinAcks++
+	for page, members := range pages {
+		ack.Payload = encodeJoinAck(joinAckPage{ack: n.joinAcks, page: page, pages: len(pages)}, members)
+		n.sendMessage(ack, addr)
+	}
+}
+
+// record a page of a join ack from the seed, return whether all pages of the ack are received.
+// The caller holds the lock.
+func (n *Node) receiveJoinPage(seed string, header joinAckPage) bool {
+	received, ok := n.joinPages[seed]
+	// pages of an earlier ack are dropped, and a later ack starts over
+	if ok && header.ack < received.ack {
+		return false
+	}
+	if !ok || header.ack > received.ack || len(received.received) != header.pages {
+		received = &joinAckPages{ack: header.ack, received: make([]bool, header.pages)}
+		n.joinPages[seed] = received
+	}
+	received.received[header.page] = true
+	for _, ok := range received.received {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Join the group through one or more seeds, it returns once the join is started.
+// The join is retried in background until it succeeds, the node leaves or is closed.
+// A node can join again after it left or is thought failed, it takes a new incarnation
+// so that members replace its old entry.
+func (n *Node) Join(seeds ...string) error {
+	// a node never joins through itself
+	var remoteSeeds []string
+	for _, seed := range seeds {
+		if seed != n.addr {
+			remoteSeeds = append(remoteSeeds, seed)
+		}
+	}
+	if len(remoteSeeds) == 0 {
+		return errors.New("no seed address given")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx == nil {
+		return errors.New("can't join before the node is started")
+	}
+	n.stopJoin()
+	n.joinPages = make(map[string]*joinAckPages)
+	n.addSeeds(remoteSeeds...)
+	n.left = false
+	n.joined = false
+	self := n.members.rejoinSelf()
+	InfoLogger.Println("Joining with incarnation", self.Incarnation, ".")
+	// probes of the old view are dropped
+	n.probe, n.probeOrder = nil, nil
+	n.pingReqs = make(map[string][]pingRequest)
+	var ctx context.Context
+	ctx, n.cancelJoin = context.WithCancel(n.ctx)
+	n.wg.Add(1)
+	go n.runJoin(ctx, remoteSeeds)
+	return nil
+}
+
+// Joined returns whether the node has received the full member list from a seed
+func (n *Node) Joined() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.joined
+}
+
+// stop the pending join, the caller holds the lock
+func (n *Node) stopJoin() {
+	if n.cancelJoin != nil {
+		n.cancelJoin()
+		n.cancelJoin = nil
+		n.joinPages = nil
+	}
+}
+
+// try the seeds in turn until one of them replies with the full member list
+func (n *Node) runJoin(ctx context.Context, seeds []string) {
+	defer n.wg.Done()
+	backoff := JoinRetryMin * time.Millisecond
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		seed := seeds[attempt%len(seeds)]
+		n.mu.Lock()
+		self, _ := n.members.getMemberById(n.id)
+		payload, err := n.codec.EncodeMembers([]Member{self})
+		if err != nil {
+			n.mu.Unlock()
+			ErrorLogger.Println("Encode error:", err)
+			return
+		}
+		n.sendMessage(Message{Method: MSG_JOIN, Payload: payload}, seed)
+		n.mu.Unlock()
+		state, err := n.syncWithSeed(ctx, seed)
+		if err == nil {
+			n.confirmJoin(ctx, seed, state.Mode, state.ModeEpoch)
+			return
+		}
+		if ctx.Err() != nil {
+			return // joined through a join ack meanwhile, or stopped
+		}
+		WarnLogger.Println("Join through", seed, "failed:", err)
+		// back off after every round of seeds
+		if (attempt+1)%len(seeds) != 0 {
+			continue
+		}
+		InfoLogger.Println("No seed is reachable, retry in", backoff)
+		select {
+		case <-ctx.Done():
+		case <-n.clock.After(backoff):
+		}
+		backoff *= 2
+		if backoff > JoinRetryMax*time.Millisecond {
+			backoff = JoinRetryMax * time.Millisecond
+		}
+	}
+}
+
+// the seed replies to the join with its member list, and to a push with its full member list.
+// Without full state sync, only wait for the join ack.
+func (n *Node) syncWithSeed(ctx context.Context, seed string) (Message, error) {
+	if n.listener != nil {
+		return n.pushPull(seed)
+	}
+	select {
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-n.clock.After(JoinAckTimeout * time.Millisecond):
+		return Message{}, errors.New("no join ack")
+	}
+}
+
+// mark the join as succeeded, unless it has been stopped
+func (n *Node) confirmJoin(ctx context.Context, seed string, mode string, epoch int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	n.finishJoin(seed, mode, epoch)
+}
+
+// mark the pending join as succeeded and switch to the mode of the group, the caller holds the lock
+func (n *Node) finishJoin(seed string, mode string, epoch int) {
+	if n.cancelJoin == nil {
+		return
+	}
+	n.joined = true
+	n.stopJoin()
+	InfoLogger.Println("Host", n.id, "joined the group through", seed, ".")
+	// the initial mode of the group is taken as well, unless the node knows a newer one
+	if n.isNewerMode(mode, epoch) || (epoch == 0 && n.modeEpoch == 0 && isValidMode(mode) && mode != n.mode) {
+		n.adoptMode(mode, epoch)
+	}
+}
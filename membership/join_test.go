@@ -0,0 +1,101 @@
+package membership
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// a node joining a cluster of 10 knows all of them within one heartbeat period,
+// also when the member list takes several datagrams, and knows all of them once joined if some are lost
+func TestJoinSeesWholeCluster(t *testing.T) {
+	tests := []struct {
+		name     string
+		metaSize int     // bytes of metadata of every member, to make the member list larger
+		lossRate float64 // an ack with a lost page is sent again, the join takes longer than a period
+	}{
+		{"one datagram", 0, 0},
+		{"several datagrams", 400, 0},
+		{"several lossy datagrams", 400, 0.1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			const size = 10
+			c := newSimCluster(t, size+1, 1, func(index int, config *Config) {
+				if test.metaSize > 0 {
+					config.Meta = map[string]string{"padding": strings.Repeat("x", test.metaSize)}
+				}
+				config.Params.MaxBufferSize = GossipBudget
+			})
+			cluster := indexes(0, size)
+			for _, index := range cluster[1:] {
+				if err := c.nodes[index].Join(simAddr(0)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.waitFor("cluster", time.Minute, func() bool {
+				for _, index := range cluster {
+					if c.nodes[index].members.Len() != size {
+						return false
+					}
+				}
+				return c.sees(cluster, cluster, STAT_RUNNING)
+			})
+			c.nodes[0].mu.Lock()
+			pages := len(c.nodes[0].membersPages(Message{Method: MSG_JOIN_ACK}, GossipBudget-joinAckHeaderSize))
+			c.nodes[0].mu.Unlock()
+			if test.metaSize > 0 && pages < 2 {
+				t.Fatalf("the member list fits in %d datagram, want several", pages)
+			}
+
+			c.network.SetLossRate(test.lossRate)
+			joiner := c.nodes[size]
+			if err := joiner.Join(simAddr(0)); err != nil {
+				t.Fatal(err)
+			}
+			elapsed := c.waitFor("join", 5*time.Minute, joiner.Joined)
+			if period := DefaultParams().HeartbeatPeriod; test.lossRate == 0 && elapsed > period {
+				t.Errorf("joined in %v, want within one period of %v", elapsed, period)
+			}
+			if !c.sees([]int{size}, cluster, STAT_RUNNING) || joiner.members.Len() != size+1 {
+				t.Errorf("the new member knows %d members once joined, want %d", joiner.members.Len(), size+1)
+			}
+		})
+	}
+}
+
+// the join only succeeds once all pages of the same ack are received
+func TestJoinAckPages(t *testing.T) {
+	n := NewNode(Config{Addr: "self:2333"})
+	n.joinPages = make(map[string]*joinAckPages)
+	steps := []struct {
+		seed   string
+		header joinAckPage
+		done   bool
+	}{
+		{"seed1", joinAckPage{1, 0, 3}, false},
+		{"seed1", joinAckPage{1, 2, 3}, false},
+		{"seed2", joinAckPage{1, 0, 2}, false}, // pages of another seed are counted apart
+		{"seed1", joinAckPage{2, 1, 3}, false}, // a later ack may split the list differently, count again
+		{"seed1", joinAckPage{1, 0, 3}, false}, // pages of an earlier ack are dropped
+		{"seed1", joinAckPage{2, 2, 3}, false},
+		{"seed1", joinAckPage{2, 0, 3}, true},
+		{"seed2", joinAckPage{3, 0, 1}, true},
+	}
+	for index, step := range steps {
+		if done := n.receiveJoinPage(step.seed, step.header); done != step.done {
+			t.Errorf("step %d: %+v from %s, done %v, want %v", index, step.header, step.seed, done, step.done)
+		}
+	}
+
+	header := joinAckPage{ack: 7, page: 2, pages: 3}
+	decoded, members, err := decodeJoinAck(encodeJoinAck(header, []byte("members")))
+	if err != nil || decoded != header || string(members) != "members" {
+		t.Errorf("decoded %+v, %q, %v", decoded, members, err)
+	}
+	if _, _, err := decodeJoinAck(encodeJoinAck(joinAckPage{ack: 1, page: 3, pages: 3}, nil)); err == nil {
+		t.Error("decoded page 3 of 3 without error")
+	}
+}
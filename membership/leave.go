@@ -0,0 +1,110 @@
+// This file contains the graceful leave of a node.
+// A leaving node marks itself left, and sends LEAVE with its own entry to all members.
+// Members ack every LEAVE, and LEAVE is sent again to members which have not acked,
+// for at most LeaveRounds rounds. The left entry also spreads by gossip,
+// so a member missing all the LEAVEs still learns it from the others.
+// The node keeps running after it left, it only stops taking part in the group.
+package membership
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaveIncomplete is returned when some members have not acked the leave in time.
+// The node has left anyway, and the members learn it by gossip or time it out.
+var ErrLeaveIncomplete = errors.New("leave is not acked by all members")
+
+// Leave the group, it blocks until all members ack the leave or LeaveRounds rounds pass.
+// The node stops heartbeating but keeps running.
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	if n.left {
+		n.mu.Unlock()
+		return errors.New("already left")
+	}
+	n.stopJoin()
+	n.left = true
+	self := n.members.setStatus(n.id, STAT_LEFT)
+	InfoLogger.Println("Host", n.id, "left the system.")
+	payload, err := n.codec.EncodeMembers([]Member{self})
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	n.leaveAcks = make(map[string]bool)
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		n.leaveAcks = nil
+		n.mu.Unlock()
+	}()
+	if n.ctx == nil {
+		return nil // not started, no one to tell
+	}
+
+	for round := 0; round < LeaveRounds; round++ {
+		n.mu.Lock()
+		pending := n.unackedMembers()
+		if len(pending) > 0 {
+			n.broadcastMessage(Message{Method: MSG_LEAVE, Payload: payload}, pending...)
+		}
+		n.mu.Unlock()
+		if len(pending) == 0 {
+			return nil
+		}
+		if !n.waitLeaveAcks(LeaveRoundPeriod * time.Millisecond) {
+			return nil // the node is closed
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if pending := n.unackedMembers(); len(pending) > 0 {
+		return fmt.Errorf("%w: %d members have not acked", ErrLeaveIncomplete, len(pending))
+	}
+	return nil
+}
+
+// active members which have not acked the leave
+func (n *Node) unackedMembers() []Member {
+	var pending []Member
+	for _, member := range n.members.Snapshot() {
+		if n.isValidRemoteMember(member) && !n.leaveAcks[member.ID] {
+			pending = append(pending, member)
+		}
+	}
+	return pending
+}
+
+// wait until the round ends or all members ack, return false if the node is closed
+func (n *Node) waitLeaveAcks(period time.Duration) bool {
+	timeout := n.clock.After(period)
+	for {
+		select {
+		case <-n.ctx.Done():
+			return false
+		case <-timeout:
+			return true
+		case <-n.leaveAcked:
+		}
+		n.mu.Lock()
+		pending := n.unackedMembers()
+		n.mu.Unlock()
+		if len(pending) == 0 {
+			return true
+		}
+	}
+}
+
+// handle leave-ack message, count the ack if leaving
+func (n *Node) handleLeaveAckMessage(message Message) {
+	if n.leaveAcks == nil {
+		return
+	}
+	n.leaveAcks[message.SenderID] = true
+	select {
+	case n.leaveAcked <- struct{}{}:
+	default:
+	}
+}
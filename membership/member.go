@@ -0,0 +1,588 @@
+// This file contains member-related structs and functions.
+package membership
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Member struct {
+	ID               string
+	Addr             string // IP address
+	HeartbeatCounter int    // heartbeat sequence
+	Incarnation      int    // bumped by the member itself to refute suspicion
+	Status           string // running, suspect, left, failed
+	Timestamp        time.Time
+	// when the status, incarnation, address or metadata last changed, local only.
+	// Heartbeats do not move it, so recently changed entries are gossiped first.
+	Changed time.Time
+	// metadata advertised by the member, never modified in place
+	Meta        map[string]string
+	MetaVersion int // bumped by the member itself when its metadata changes
+}
+
+const (
+	STAT_RUNNING = "Running" // running
+	STAT_SUSPECT = "Suspect" // suspected to be failed, may be refuted
+	STAT_LEFT    = "Left"    // left
+	STAT_FAILED  = "Failed"  // failed
+)
+
+// MemberList is a membership list safe for concurrent use.
+// Entries are never shared with callers, reads return copies.
+type MemberList struct {
+	mu       sync.RWMutex
+	selfID   string // id of the local member
+	members  []Member
+	detector FailureDetector // told about heartbeats and removed members
+	events   eventHub        // changes are published to subscribers
+	clock    Clock           // timestamps of members
+	metrics  *metrics        // counts detections and refutations, nil if not counted
+	health   *health         // local health, lowered by refutations, nil if not scored
+
+	tombstones map[string]tombstone // removed or unknown dead members by id
+}
+
+// create a member list holding only the local member
+func NewMemberList(self Member, detector FailureDetector, clock Clock) *MemberList {
+	if detector == nil {
+		detector = NewTimeoutDetector()
+	}
+	if clock == nil {
+		clock = NewRealClock()
+	}
+	DebugLogger.Printf("Init memberlist success.\n")
+	return &MemberList{
+		selfID:     self.ID,
+		members:    []Member{self},
+		detector:   detector,
+		clock:      clock,
+		tombstones: make(map[string]tombstone),
+	}
+}
+
+// generate an unique ID
+func generateUniqueId(addr string, now time.Time) string {
+	// id that includes a timestamp and IP address
+	return fmt.Sprintf(
+		"%d@%s",
+		now.Unix()%(1000000), // last six digits of timestamp
+		addr)
+}
+
+// print a single membership
+func printMember(m Member) {
+	fmt.Printf("  - %s, status: %s, timestamp: %s, address: %s, heartbeat counter: %d, incarnation: %d", m.ID, m.Status, m.Timestamp.Format("2006-01-02 15:04:05"), m.Addr, m.HeartbeatCounter, m.Incarnation)
+	if len(m.Meta) > 0 {
+		fmt.Printf(", meta: %s", formatMeta(m.Meta))
+	}
+}
+
+// print the membership list, only members with all the tags if any is given
+func (n *Node) printMemberList(tags ...string) {
+	fmt.Printf("MemberList: \n")
+	phiDetector, isPhi := n.detector.(*PhiAccrualDetector)
+	now := n.clock.Now()
+	for _, m := range n.members.Snapshot() {
+		if !matchTags(m, tags) {
+			continue
+		}
+		printMember(m)
+		if isPhi && m.ID != n.id {
+			fmt.Printf(", phi: %.2f", phiDetector.Phi(m.ID, now))
+		}
+		fmt.Println()
+	}
+	InfoLogger.Println("Mode epoch:", n.modeEpoch)
+	InfoLogger.Println("Local health score:", n.health.get(), ", timeouts are scaled by", n.health.multiplier(), ".")
+	switch n.mode {
+	case MODE_GOSSIP:
+		InfoLogger.Println("Current Membership Mode: Gossip Style.")
+	case MODE_SWIM:
+		InfoLogger.Println("Current Membership Mode: SWIM Style.")
+	default:
+		InfoLogger.Println("Current Membership Mode: All-to-All Style.")
+	}
+}
+
+// initialize the local member list
+func (n *Node) initializeMemberInfo() {
+	self := Member{
+		ID:               n.id,
+		Status:           STAT_RUNNING,
+		HeartbeatCounter: 0,
+		Timestamp:        n.clock.Now(),
+		Changed:          n.clock.Now(),
+		Addr:             n.addr,
+	}
+	if len(n.config.Meta) > 0 {
+		self.Meta = copyMeta(n.config.Meta)
+		self.MetaVersion = 1
+	}
+	n.members = NewMemberList(self, n.detector, n.clock)
+	n.members.metrics = n.metrics
+	n.members.health = n.health
+}
+
+// whether the member is an active remote host, suspected members are still active
+func (n *Node) isValidRemoteMember(member Member) bool {
+	return member.ID != n.id && isActive(member)
+}
+
+// whether the member is running or suspected
+func isActive(member Member) bool {
+	return member.Status == STAT_RUNNING || member.Status == STAT_SUSPECT
+}
+
+// return at most requiredSize random active members
+func (n *Node) getRandomMembers(requiredSize int) []Member {
+	tmpList := n.members.Snapshot()
+	// shuffle the slice
+	rand.Shuffle(len(tmpList), func(i, j int) { tmpList[i], tmpList[j] = tmpList[j], tmpList[i] })
+
+	resultList := make([]Member, 0, requiredSize)
+	for _, member := range tmpList {
+		if len(resultList) == requiredSize {
+			break
+		}
+		if n.isValidRemoteMember(member) {
+			resultList = append(resultList, member)
+		}
+	}
+	return resultList
+}
+
+// Subscribe returns a channel of membership changes, closed when the list is closed.
+// Events of the same member are delivered in the order they happened.
+func (l *MemberList) Subscribe() <-chan MemberEvent {
+	return l.events.subscribe()
+}
+
+// close all subscriptions
+func (l *MemberList) Close() {
+	l.events.close()
+}
+
+// publish a change of member, and mark the entry as changed now. The caller holds the lock.
+func (l *MemberList) emit(kind EventKind, member *Member) {
+	member.Changed = l.clock.Now()
+	l.events.publish(MemberEvent{Kind: kind, Member: *member})
+}
+
+// publish a change of member
+func (l *MemberList) notify(kind EventKind, member Member) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.emit(kind, &member)
+}
+
+// Snapshot returns a copy of all members
+func (l *MemberList) Snapshot() []Member {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	members := make([]Member, len(l.members))
+	copy(members, l.members)
+	return members
+}
+
+// Len returns the number of members, including failed and left ones
+func (l *MemberList) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.members)
+}
+
+// find the entry of a member, the caller holds the lock
+func (l *MemberList) find(id string) *Member {
+	for ind := range l.members {
+		if l.members[ind].ID == id {
+			return &l.members[ind]
+		}
+	}
+	return nil
+}
+
+// get a copy of the member with the id
+func (l *MemberList) getMemberById(id string) (Member, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if member := l.find(id); member != nil {
+		return *member, true
+	}
+	return Member{}, false
+}
+
+// merge membership list, an entry overrides the local one by its incarnation and status, see tombstone.go
+// counters are only merged when mergeCounters is set, as all-to-all counters are counted by each observer
+func (l *MemberList) mergeGossipMemberList(newMemberList []Member, mergeCounters bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, member := range newMemberList {
+		// if is itself, refute the suspicion about it
+		if member.ID == l.selfID {
+			l.refuteSuspicion(member)
+			continue
+		}
+		// search its corresponding member in the list
+		oldMember := l.find(member.ID)
+		// if not found
+		if oldMember == nil {
+			// a removed member is only added again by a newer entry than its tombstone
+			if l.buried(member) {
+				continue
+			}
+			// only insert a new member if it is active, otherwise remember that it is dead
+			if !isActive(member) {
+				l.bury(member)
+				continue
+			}
+			delete(l.tombstones, member.ID)
+			newMember := l.add(Member{
+				ID:          member.ID,
+				Addr:        member.Addr,
+				Incarnation: member.Incarnation,
+				Meta:        member.Meta,
+				MetaVersion: member.MetaVersion,
+			})
+			if member.Status == STAT_SUSPECT {
+				l.suspect(newMember)
+			}
+			continue
+		}
+		// a newer incarnation, or a stronger status of the same incarnation, overrides the old entry
+		if overrides(member, *oldMember) {
+			switch {
+			case isActive(member):
+				// only a newer incarnation, it is how a member refutes suspicion or rejoins
+				if member.Status == STAT_RUNNING && oldMember.Status == STAT_SUSPECT {
+					InfoLogger.Println("Member", member.ID, "refuted the suspicion.")
+					l.metrics.countRefutation(REFUTE_MEMBER)
+				}
+				if member.Incarnation > oldMember.Incarnation {
+					l.revive(oldMember, member)
+				} else {
+					// suspicion of the same incarnation spreads
+					l.suspect(oldMember)
+				}
+			case member.Status == STAT_FAILED && member.Incarnation == oldMember.Incarnation && !mergeCounters:
+				// all-to-all failures are local only, as every member watches the heartbeats itself
+			default:
+				// a failure or a leave spreads
+				oldStatus := oldMember.Status
+				oldMember.Status = member.Status
+				oldMember.Incarnation = member.Incarnation
+				oldMember.Timestamp = l.clock.Now()
+				InfoLogger.Println("Member", member.ID, "is", member.Status, "as gossiped.")
+				l.emitStatusChange(oldStatus, oldMember)
+			}
+		}
+		// newer metadata wins
+		if member.MetaVersion > oldMember.MetaVersion {
+			oldMember.Meta = member.Meta
+			oldMember.MetaVersion = member.MetaVersion
+			DebugLogger.Println("Updated the metadata of", member.ID, "to version", member.MetaVersion)
+			l.emit(EVENT_UPDATE, oldMember)
+		}
+		// compare, if outdated, update the entry
+		if mergeCounters && isActive(*oldMember) && oldMember.HeartbeatCounter < member.HeartbeatCounter {
+			DebugLogger.Println("Updated the member:", member.ID)
+			oldMember.HeartbeatCounter = member.HeartbeatCounter
+			l.detector.Heartbeat(member.ID, l.clock.Now())
+			// the timestamp of a suspected member is when the suspicion started
+			if oldMember.Status == STAT_RUNNING {
+				oldMember.Timestamp = l.clock.Now()
+			}
+		}
+	}
+}
+
+// mark a member as suspected, the suspicion timer starts from now
+func (l *MemberList) suspectMember(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if member := l.find(id); member != nil && l.suspect(member) {
+		l.metrics.countSuspicion()
+	}
+}
+
+// return whether the member was running and is suspected now
+func (l *MemberList) suspect(member *Member) bool {
+	if member.Status != STAT_RUNNING {
+		return false
+	}
+	member.Status = STAT_SUSPECT
+	member.Timestamp = l.clock.Now()
+	InfoLogger.Println("Host", member.ID, "is suspected.")
+	l.emit(EVENT_SUSPECT, member)
+	return true
+}
+
+// confirm the failure of a suspected member
+func (l *MemberList) failMember(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	member := l.find(id)
+	if member == nil || member.Status != STAT_SUSPECT {
+		return
+	}
+	member.Status = STAT_FAILED
+	member.Timestamp = l.clock.Now()
+	InfoLogger.Println("Host", id, "failed.")
+	l.metrics.countFailure()
+	l.emit(EVENT_FAIL, member)
+}
+
+// when others suspect this node or think it failed or left, bump the incarnation so that it is overridden.
+// A node which has left does not refute.
+func (l *MemberList) refuteSuspicion(member Member) {
+	self := l.find(l.selfID)
+	if self == nil || self.Status != STAT_RUNNING || member.Status == STAT_RUNNING || member.Incarnation < self.Incarnation {
+		return
+	}
+	self.Incarnation = member.Incarnation + 1
+	InfoLogger.Println("Refuted suspicion with incarnation", self.Incarnation, ".")
+	l.metrics.countRefutation(REFUTE_SELF)
+	// others suspecting this node may be a sign that it is slow
+	l.health.apply(1)
+	l.emit(EVENT_UPDATE, self)
+}
+
+// renew a member when receiving its ping, the heartbeat of its own period.
+// The arrival is recorded by the failure detector, once per period of the member.
+// if clearSuspicion is set, a suspected member is running again, as all-to-all suspicion is local only
+func (l *MemberList) heartbeatFromMember(heartbeatID string, heartbeatAddrStr string, clearSuspicion bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.detector.Heartbeat(heartbeatID, l.clock.Now())
+	if member := l.renew(heartbeatID, heartbeatAddrStr, clearSuspicion); member != nil {
+		member.HeartbeatCounter++
+	}
+}
+
+// renew a member when receiving its pong or join ack. It replies to a message of the local node,
+// so it is not a heartbeat of the member, and its arrival is not recorded by the failure detector.
+func (l *MemberList) replyFromMember(id string, addr string, clearSuspicion bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.renew(id, addr, clearSuspicion)
+}
+
+// mark a member alive now, insert it if unknown and not buried, return the entry if it was known.
+// The caller holds the lock.
+func (l *MemberList) renew(heartbeatID string, heartbeatAddrStr string, clearSuspicion bool) *Member {
+	member := l.find(heartbeatID)
+	if member == nil {
+		// a removed member comes back by joining again with a newer incarnation
+		if !l.buried(Member{ID: heartbeatID}) {
+			l.insert(heartbeatID, heartbeatAddrStr)
+		}
+		return nil
+	}
+	changed := member.Addr != heartbeatAddrStr
+	member.Addr = heartbeatAddrStr
+	member.Timestamp = l.clock.Now()
+	if member.Status == STAT_SUSPECT && clearSuspicion {
+		member.Status = STAT_RUNNING
+		InfoLogger.Println("Member", heartbeatID, "is no longer suspected.")
+		l.metrics.countRefutation(REFUTE_MEMBER)
+		changed = true
+	}
+	if changed {
+		l.emit(EVENT_UPDATE, member)
+	}
+	return member
+}
+
+// renew a member on an ack without touching its counter, insert it if unknown
+func (l *MemberList) ackFromMember(id string, addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.detector.Heartbeat(id, l.clock.Now())
+	if member := l.find(id); member == nil {
+		if !l.buried(Member{ID: id}) {
+			l.insert(id, addr)
+		}
+	} else if member.Status == STAT_RUNNING {
+		// a suspected member stays suspected until it refutes with a new incarnation
+		member.Timestamp = l.clock.Now()
+	}
+}
+
+// increase the heartbeat counter of a member, used for the local member
+func (l *MemberList) incrementHeartbeat(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if member := l.find(id); member != nil {
+		member.HeartbeatCounter++
+	}
+}
+
+// empty the heartbeat counters of all other members
+func (l *MemberList) resetHeartbeats() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.members {
+		if l.members[i].ID != l.selfID {
+			l.members[i].HeartbeatCounter = 0
+		}
+	}
+}
+
+// set the status of a member
+func (l *MemberList) setStatus(id string, status string) Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	member := l.find(id)
+	if member == nil {
+		return Member{}
+	}
+	oldStatus := member.Status
+	member.Status = status
+	member.Timestamp = l.clock.Now()
+	l.emitStatusChange(oldStatus, member)
+	return *member
+}
+
+// publish the event of a status change, the caller holds the lock
+func (l *MemberList) emitStatusChange(oldStatus string, member *Member) {
+	switch {
+	case oldStatus == member.Status:
+		l.emit(EVENT_UPDATE, member)
+	case member.Status == STAT_SUSPECT:
+		l.emit(EVENT_SUSPECT, member)
+	case member.Status == STAT_FAILED:
+		l.emit(EVENT_FAIL, member)
+	case member.Status == STAT_LEFT:
+		l.emit(EVENT_LEAVE, member)
+	case oldStatus == STAT_SUSPECT:
+		l.emit(EVENT_UPDATE, member)
+	default: // running again after failed or left
+		l.emit(EVENT_JOIN, member)
+	}
+}
+
+// insert a new member into the member list
+func (l *MemberList) insertMember(newMemberID string, newMemberAddrStr string) Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return *l.insert(newMemberID, newMemberAddrStr)
+}
+
+// insert a new member, return the new entry, the caller holds the lock
+func (l *MemberList) insert(newMemberID string, newMemberAddrStr string) *Member {
+	return l.add(Member{ID: newMemberID, Addr: newMemberAddrStr})
+}
+
+// insert a new running member with its id, address, incarnation and metadata,
+// return the new entry, the caller holds the lock
+func (l *MemberList) add(newMember Member) *Member {
+	newMember.Status = STAT_RUNNING
+	newMember.HeartbeatCounter = 1
+	newMember.Timestamp = l.clock.Now()
+	l.members = append(l.members, newMember)
+	InfoLogger.Println("Member", newMember.ID, "is added into the member list.")
+	member := &l.members[len(l.members)-1]
+	l.emit(EVENT_JOIN, member)
+	return member
+}
+
+// add a joining member, or replace its entry of an older incarnation
+func (l *MemberList) joinMember(member Member) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	oldMember := l.find(member.ID)
+	switch {
+	case oldMember == nil && l.buried(member):
+		DebugLogger.Println("Ignored a stale join of removed", member.ID)
+	case oldMember == nil:
+		delete(l.tombstones, member.ID)
+		l.add(member)
+	case member.Incarnation > oldMember.Incarnation:
+		l.revive(oldMember, member)
+	case member.Incarnation == oldMember.Incarnation && isActive(*oldMember):
+		// the join is sent again, the member is alive
+		oldStatus := oldMember.Status
+		oldMember.Addr = member.Addr
+		oldMember.Status = STAT_RUNNING
+		oldMember.Timestamp = l.clock.Now()
+		if oldStatus != STAT_RUNNING {
+			l.emitStatusChange(oldStatus, oldMember)
+		}
+	default:
+		DebugLogger.Println("Ignored a stale join of", member.ID)
+	}
+}
+
+// replace an entry by a newer incarnation of the member, it runs again even if it failed or left.
+// The caller holds the lock.
+func (l *MemberList) revive(oldMember *Member, member Member) {
+	oldStatus := oldMember.Status
+	oldMember.Addr = member.Addr
+	oldMember.Incarnation = member.Incarnation
+	oldMember.Status = STAT_RUNNING
+	oldMember.Timestamp = l.clock.Now()
+	if member.MetaVersion > oldMember.MetaVersion {
+		oldMember.Meta, oldMember.MetaVersion = member.Meta, member.MetaVersion
+	}
+	if oldStatus == STAT_FAILED || oldStatus == STAT_LEFT {
+		// the history of heartbeats is from the old incarnation
+		l.detector.Remove(member.ID)
+		InfoLogger.Println("Member", member.ID, "rejoined with incarnation", member.Incarnation, ".")
+	}
+	l.emitStatusChange(oldStatus, oldMember)
+	if member.Status == STAT_SUSPECT {
+		l.suspect(oldMember)
+	}
+}
+
+// take a new incarnation and run again, so that the entries of others about this node are replaced.
+// Members not running are forgotten, the seed tells which of them are still there.
+func (l *MemberList) rejoinSelf() Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var removed []Member
+	members := l.members[:0]
+	for _, member := range l.members {
+		if member.ID != l.selfID && member.Status != STAT_RUNNING {
+			removed = append(removed, member)
+			continue
+		}
+		members = append(members, member)
+	}
+	l.members = members
+	for index := range removed {
+		l.detector.Remove(removed[index].ID)
+		l.emit(EVENT_REMOVE, &removed[index])
+	}
+	self := l.find(l.selfID)
+	oldStatus := self.Status
+	self.Incarnation++
+	self.Status = STAT_RUNNING
+	self.Timestamp = l.clock.Now()
+	if oldStatus != STAT_RUNNING {
+		l.emitStatusChange(oldStatus, self)
+	}
+	return *self
+}
+
+// remove a failed or left member from the member list
+func (l *MemberList) removeMember(oldMember Member) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for index := range l.members {
+		if l.members[index].ID == oldMember.ID {
+			if isActive(l.members[index]) {
+				return // revived since it was checked
+			}
+			removedMember := l.members[index]
+			l.members = append(l.members[:index], l.members[index+1:]...)
+			l.bury(removedMember)
+			l.detector.Remove(oldMember.ID)
+			InfoLogger.Println("Member", oldMember.ID, "is removed from the member list.")
+			l.emit(EVENT_REMOVE, &removedMember)
+			return
+		}
+	}
+}
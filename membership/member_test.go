@@ -0,0 +1,83 @@
+package membership
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hammer the member list from several goroutines, run with -race
+func TestMemberListConcurrent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	self := Member{ID: "self", Addr: "self:2333", Status: STAT_RUNNING}
+	list := NewMemberList(self, NewTimeoutDetector(), clock)
+	defer list.Close()
+	events := list.Subscribe()
+	go func() {
+		for range events {
+		}
+	}()
+
+	const workers = 8
+	const rounds = 500
+	id := func(random *rand.Rand) string {
+		return fmt.Sprintf("member%d", random.Intn(20))
+	}
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+			for i := 0; i < rounds; i++ {
+				switch random.Intn(7) {
+				case 0:
+					member := id(random)
+					list.heartbeatFromMember(member, member+":2333", random.Intn(2) == 0)
+				case 1:
+					member := id(random)
+					list.mergeGossipMemberList([]Member{{
+						ID:               member,
+						Addr:             member + ":2333",
+						HeartbeatCounter: random.Intn(100),
+						Incarnation:      random.Intn(3),
+						Status:           statusCodes[random.Intn(len(statusCodes))],
+					}, {ID: self.ID, Status: STAT_SUSPECT, Incarnation: random.Intn(3)}}, random.Intn(2) == 0)
+				case 2:
+					list.suspectMember(id(random))
+				case 3:
+					list.failMember(id(random))
+				case 4:
+					for _, member := range list.Snapshot() {
+						if member.ID != self.ID && !isActive(member) {
+							list.removeMember(member)
+						}
+					}
+				case 5:
+					for _, member := range list.Snapshot() {
+						if member.ID == "" {
+							t.Error("empty entry in the snapshot")
+						}
+					}
+				case 6:
+					clock.Advance(10 * time.Millisecond)
+				}
+			}
+		}(int64(worker))
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, member := range list.Snapshot() {
+		if seen[member.ID] {
+			t.Errorf("member %s is listed twice", member.ID)
+		}
+		seen[member.ID] = true
+	}
+	entry, ok := list.getMemberById(self.ID)
+	if !ok || entry.Status != STAT_RUNNING {
+		t.Errorf("the local member is %+v, want running", entry)
+	}
+}
@@ -0,0 +1,381 @@
+// This file contains message-related structs and functions.
+// Possible messages:
+//  1. ping id addr :
+//     - all-to-all mode: reply with pong, no payload needed
+//     - gossip mode: no reply, member list needs to be the payload
+//     - swim mode: reply with pong, member list is piggybacked on both
+//  2. pong id addr : no reply, and update membership list
+//  3. join id addr : reply with join ack and forward it to all members if it comes from the new member,
+//     otherwise reply with pong. A forwarded join carries the id of the forwarding member as payload
+//  4. leave id addr : no reply, and delete its entry in membership list
+//  5. switch : no reply, switch to the mode of the message if its epoch is newer
+//  6. ping-req id addr : probe the target in payload, forward its pong to the sender
+//  7. join-ack id addr : no reply, merge the member list in payload and switch to the mode
+//  8. meta id addr : no reply, merge the member in payload with its new metadata
+//
+// Every message carries the mode of the sender and its epoch, nodes take the mode of the newest epoch,
+// so a switch is spread with heartbeats and full state syncs even if the switch message is lost.
+//
+// Gossip payloads only carry the members that fit into GossipBudget bytes,
+// the full member list is synced over TCP, see pushpull.go.
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Message from other remote hosts
+type Message struct {
+	Method     string
+	SenderID   string
+	SenderAddr string
+	Payload    []byte
+	Mode       string // heartbeat mode of the sender
+	ModeEpoch  int    // bumped by every switch, the mode of the newest epoch wins
+}
+
+const (
+	MSG_PING      = "PING"
+	MSG_PONG      = "PONG"
+	MSG_JOIN      = "JOIN"
+	MSG_JOIN_ACK  = "JOIN_ACK"
+	MSG_LEAVE     = "LEAVE"
+	MSG_LEAVE_ACK = "LEAVE_ACK"
+	MSG_SWITCH    = "SWITCH"
+	MSG_META      = "META"
+	MSG_PARAMS    = "PARAMS"
+	MSG_HEAL      = "HEAL"
+	MSG_HEAL_ACK  = "HEAL_ACK"
+	// swim related
+	MSG_PING_REQ = "PING_REQ"
+	// full state sync over TCP, see pushpull.go
+	MSG_PUSH_PULL = "PUSH_PULL"
+)
+
+// read from UDP continuously and file them into the channel
+func (n *Node) readMessage(ctx context.Context) {
+	defer n.wg.Done()
+	// max buffer size can be changed while reading, so the buffer fits any datagram
+	dataBuffer := make([]byte, maxDatagramSize)
+	for {
+		// receiver process
+		cnt, remoteAddr, err := n.transport.ReadFrom(dataBuffer)
+		if err != nil {
+			if ctx.Err() == nil {
+				ErrorLogger.Println("failed to read from UDP:" + err.Error())
+			}
+			return
+		}
+		n.metrics.countBytesIn(cnt)
+		data, err := n.openMessage(dataBuffer[0:cnt])
+		if err != nil {
+			n.metrics.countDropped(DROP_AUTH)
+			WarnLogger.Println("Dropped a message from", remoteAddr, ":", err)
+			continue
+		}
+		// deserialize received message
+		inMessage, err := n.codec.DecodeMessage(data)
+		if errors.Is(err, ErrVersionMismatch) {
+			n.metrics.countDropped(DROP_VERSION)
+			WarnLogger.Println("Dropped a message from", remoteAddr, "with another codec or protocol version:", err)
+			continue
+		} else if err != nil {
+			n.metrics.countDropped(DROP_DECODE)
+			ErrorLogger.Println("Decode error:", err)
+			continue
+		}
+		n.metrics.countReceived(inMessage.Method)
+		select {
+		case n.messages <- inMessage:
+		case <-ctx.Done():
+			return
+		}
+		DebugLogger.Println("Message Received From", inMessage.SenderID)
+	}
+}
+
+// set the sender and the mode of a message, unless they are set
+func (n *Node) stampMessage(message Message) Message {
+	if message.SenderID == "" {
+		message.SenderID = n.id
+	}
+	if message.SenderAddr == "" {
+		message.SenderAddr = n.addr
+	}
+	if message.Mode == "" {
+		message.Mode = n.mode
+		message.ModeEpoch = n.modeEpoch
+	}
+	return message
+}
+
+// send a message via UDP to a remote address
+func (n *Node) sendMessage(outMessage Message, remoteAddrStr string) {
+	outMessage = n.stampMessage(outMessage)
+
+	// send via the transport, so that the source port is the listening port
+	if n.transport == nil {
+		ErrorLogger.Println("Can't send before the node is started.")
+		return
+	}
+
+	// serialize message
+	messageBytes, err := n.sealMessage(outMessage)
+	if err != nil {
+		ErrorLogger.Println("Encode error:", err)
+		return
+	}
+
+	// simulate message loss
+	if n.config.MessageLossRate > 0 {
+		if rand.Float64() <= n.config.MessageLossRate {
+			n.metrics.countDropped(DROP_LOSS)
+			return // like the message is lost
+		}
+	}
+
+	// send message via udp
+	err = n.transport.WriteTo(messageBytes, remoteAddrStr)
+	if err != nil {
+		n.metrics.countDropped(DROP_SEND)
+		ErrorLogger.Println("Failed to write to udp:", err.Error())
+		return
+	}
+
+	// added statistics
+	n.bandwidthUsage += len(messageBytes)
+	n.metrics.countSent(outMessage.Method, len(messageBytes))
+	DebugLogger.Println("Message Sent To", remoteAddrStr)
+}
+
+// serialize a message, sign and encrypt it if a keyring is configured
+func (n *Node) sealMessage(message Message) ([]byte, error) {
+	messageBytes, err := n.codec.EncodeMessage(message)
+	if err != nil || n.auth == nil {
+		return messageBytes, err
+	}
+	messageBytes = n.auth.sign(messageBytes)
+	if n.auth.ciphers == nil {
+		return messageBytes, nil
+	}
+	return n.auth.encrypt(messageBytes)
+}
+
+// decrypt and verify a received message if a keyring is configured, return the serialized message
+func (n *Node) openMessage(data []byte) ([]byte, error) {
+	if n.auth == nil {
+		return data, nil
+	}
+	if n.auth.ciphers != nil {
+		var err error
+		if data, err = n.auth.decrypt(data); err != nil {
+			return nil, err
+		}
+	}
+	return n.auth.verify(data)
+}
+
+// size added to every message by signature and encryption
+func (n *Node) sealOverhead() int {
+	if n.auth == nil {
+		return 0
+	}
+	return n.auth.overhead()
+}
+
+// handle and dispatch received message
+func (n *Node) handleMessage(message Message) {
+	// a node that has left ignores all messages, except acks of its leave
+	if n.left {
+		if message.Method == MSG_LEAVE_ACK {
+			n.handleLeaveAckMessage(message)
+		}
+		return
+	}
+	n.observeMode(message)
+	// check on input message----Message type
+	switch message.Method {
+	case MSG_PING: // ping, used for heartbeat
+		n.handlePingMessage(message)
+	case MSG_PONG: // pong, used for heartbeat
+		n.handlePongMessage(message)
+	case MSG_JOIN: // join, used for the join of a new machine
+		n.handleJoinMessage(message)
+	case MSG_JOIN_ACK: // join-ack, the member list for a new machine
+		n.handleJoinAckMessage(message)
+	case MSG_LEAVE: // leave, used for the leave of a new machine
+		n.handleLeaveMessage(message)
+	case MSG_SWITCH: // switch to another heartbeat style, the mode is taken above
+		DebugLogger.Println("Switch to", message.Mode, "at epoch", message.ModeEpoch, "from", message.SenderID)
+	case MSG_META: // meta, used for metadata changes in all-to-all mode
+		n.handleMetaMessage(message)
+	case MSG_PARAMS: // params, used for spreading protocol parameters
+		n.handleParamsMessage(message)
+	case MSG_PING_REQ: // ping-req, used for indirect probe in swim mode
+		n.handlePingReqMessage(message)
+	case MSG_HEAL: // heal, used for merging the member lists of two sides of a partition
+		n.handleHealMessage(message)
+	case MSG_HEAL_ACK: // heal-ack, the member list of the other side
+		n.handleHealAckMessage(message)
+	default:
+		WarnLogger.Println("Unsupported Message!")
+	}
+}
+
+// handle ping message
+func (n *Node) handlePingMessage(message Message) {
+	if n.mode == MODE_SWIM { // if swim mode
+		if message.Payload == nil { // swim ping should have piggybacked payload
+			DebugLogger.Println("A ping with a different heartbeating style is dropped. (Normal for switch)")
+			return
+		}
+		piggybackMemberList, err := n.codec.DecodeMembers(message.Payload)
+		if err != nil {
+			ErrorLogger.Println("Decode error:", err)
+			return
+		}
+		n.members.mergeGossipMemberList(piggybackMemberList, true)
+		// ack with pong, piggyback own member list
+		n.sendMessage(Message{Method: MSG_PONG, Payload: n.gossipPayload(MSG_PONG)}, message.SenderAddr)
+	} else if n.mode == MODE_GOSSIP { // if gossip mode
+		if message.Payload == nil { // gossip message should have payload
+			InfoLogger.Println("A ping with a different heartbeating style is dropped. (Normal for switch)")
+			return
+		}
+		gossipMemberList, err := n.codec.DecodeMembers(message.Payload)
+		if err != nil {
+			ErrorLogger.Println("Decode error:", err)
+			return
+		}
+		// merge member list
+		n.members.mergeGossipMemberList(gossipMemberList, true)
+		DebugLogger.Println("Merged gossip from", message.SenderID, ".")
+	} else { // if not gossip mode
+		// when current process is all-to-all mode and others are gossip mode
+		if message.Payload != nil {
+			DebugLogger.Println("A ping with a different heartbeating style is dropped. (Normal for switch)")
+			return
+		}
+		// update member list
+		n.members.heartbeatFromMember(message.SenderID, message.SenderAddr, n.mode == MODE_ALL_TO_ALL)
+		//  reply with pong
+		n.sendMessage(Message{Method: MSG_PONG}, message.SenderAddr)
+	}
+}
+
+// handle pong message
+func (n *Node) handlePongMessage(message Message) {
+	if n.mode == MODE_SWIM {
+		if message.Payload != nil {
+			piggybackMemberList, err := n.codec.DecodeMembers(message.Payload)
+			if err != nil {
+				ErrorLogger.Println("Decode error:", err)
+				return
+			}
+			n.members.mergeGossipMemberList(piggybackMemberList, true)
+		}
+		n.handleSwimAck(message)
+		return
+	}
+	// update member list
+	delete(n.pendingPongs, message.SenderID)
+	n.members.replyFromMember(message.SenderID, message.SenderAddr, n.mode == MODE_ALL_TO_ALL)
+}
+
+// handle join message
+// When a host received join, it would update its member list.
+// The payload is the new member, a newer incarnation of it replaces its failed or left entry.
+// Any member can be the introducer, it broadcasts the join coming from the new member itself.
+func (n *Node) handleJoinMessage(message Message) {
+	memberList, err := n.codec.DecodeMembers(message.Payload)
+	if err != nil || len(memberList) != 1 {
+		ErrorLogger.Println("Invalid join from", message.SenderID, ":", err)
+		return
+	}
+	// updated the new member in member list
+	joiner := memberList[0]
+	n.members.joinMember(joiner)
+
+	// a forwarded join, respond to the new member about self information
+	if joiner.ID != message.SenderID {
+		n.sendMessage(Message{Method: MSG_PONG}, joiner.Addr)
+		return
+	}
+
+	// respond to the new member with the whole member list and the current mode
+	n.sendJoinAcks(message.SenderAddr)
+
+	// introducer would broadcast the message to all other active members in the group, as the sender
+	forward := Message{Method: MSG_JOIN, Payload: message.Payload}
+	for _, member := range n.members.Snapshot() {
+		// the new member does not need its own join
+		if member.ID != joiner.ID && n.isValidRemoteMember(member) {
+			n.sendMessage(forward, member.Addr)
+		}
+	}
+}
+
+// handle join ack message
+// The new member merges the member list of the introducer, page by page,
+// and once all pages are received, the join succeeds and it switches to the mode of the introducer.
+func (n *Node) handleJoinAckMessage(message Message) {
+	header, payload, err := decodeJoinAck(message.Payload)
+	if err != nil {
+		ErrorLogger.Println("Invalid join ack from", message.SenderID, ":", err)
+		return
+	}
+	memberList, err := n.codec.DecodeMembers(payload)
+	if err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	// a late ack does not change the mode of a joined node
+	if n.cancelJoin == nil {
+		n.members.mergeGossipMemberList(memberList, n.mode != MODE_ALL_TO_ALL)
+		return
+	}
+	if n.receiveJoinPage(message.SenderID, header) {
+		n.finishJoin(message.SenderAddr, message.Mode, message.ModeEpoch)
+	}
+	n.members.mergeGossipMemberList(memberList, n.mode != MODE_ALL_TO_ALL)
+	n.members.replyFromMember(message.SenderID, message.SenderAddr, n.mode == MODE_ALL_TO_ALL)
+}
+
+// handle leave message
+func (n *Node) handleLeaveMessage(message Message) {
+	// the payload is the leaving member, merged so that its leave spreads by gossip as well
+	memberList, err := n.codec.DecodeMembers(message.Payload)
+	if err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	n.members.mergeGossipMemberList(memberList, n.mode != MODE_ALL_TO_ALL)
+	// ack every copy, the leaving member retransmits until acked
+	n.sendMessage(Message{Method: MSG_LEAVE_ACK}, message.SenderAddr)
+}
+
+// broadcast a message to all other members
+func (n *Node) broadcastMessage(message Message, members ...Member) {
+	if len(members) == 0 {
+		members = n.members.Snapshot()
+	}
+	for _, member := range members {
+		// not send to oneself and left or failed host
+		if member.ID == n.id || member.Status == STAT_LEFT || member.Status == STAT_FAILED {
+			continue
+		}
+		n.sendMessage(message, member.Addr)
+	}
+}
+
+func messageToString(message Message) string {
+	return fmt.Sprintf(
+		"Method %s from host %s to %s, payload: %s",
+		message.Method,
+		message.SenderID,
+		message.SenderAddr,
+		string(message.Payload))
+}
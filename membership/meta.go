@@ -0,0 +1,129 @@
+// This file contains the metadata of members, such as role, zone, version and service ports.
+// A member advertises its metadata with a version, which is bumped on every change.
+// Metadata spreads with gossip and full state syncs, and the newer version wins.
+// In all-to-all mode, heartbeats carry no member list, so a change is also sent to all members.
+package membership
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// check the bounds of metadata
+func validateMeta(meta map[string]string) error {
+	if len(meta) > MaxMetaEntries {
+		return fmt.Errorf("too many metadata entries: %d > %d", len(meta), MaxMetaEntries)
+	}
+	size := 0
+	for key, value := range meta {
+		if key == "" || strings.ContainsAny(key, "=, ") {
+			return fmt.Errorf("invalid metadata key: %q", key)
+		}
+		size += len(key) + len(value)
+	}
+	if size > MaxMetaSize {
+		return fmt.Errorf("metadata is too large: %d > %d bytes", size, MaxMetaSize)
+	}
+	return nil
+}
+
+// ParseMeta parses metadata in the format of key=value,key=value
+func ParseMeta(input string) (map[string]string, error) {
+	meta := make(map[string]string)
+	if input == "" {
+		return meta, nil
+	}
+	for _, entry := range strings.Split(input, ",") {
+		pair := strings.SplitN(entry, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid metadata entry: %q", entry)
+		}
+		meta[pair[0]] = pair[1]
+	}
+	return meta, validateMeta(meta)
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	copied := make(map[string]string, len(meta))
+	for key, value := range meta {
+		copied[key] = value
+	}
+	return copied
+}
+
+// format metadata as key=value pairs sorted by key
+func formatMeta(meta map[string]string) string {
+	pairs := make([]string, 0, len(meta))
+	for key, value := range meta {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// whether the member has all the tags, a tag is either key=value or only a key
+func matchTags(member Member, tags []string) bool {
+	for _, tag := range tags {
+		pair := strings.SplitN(tag, "=", 2)
+		value, ok := member.Meta[pair[0]]
+		if !ok || (len(pair) == 2 && value != pair[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetMeta sets a metadata entry of the node, an empty value removes the entry
+func (n *Node) SetMeta(key string, value string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	self, _ := n.members.getMemberById(n.id)
+	meta := copyMeta(self.Meta)
+	if value == "" {
+		delete(meta, key)
+	} else {
+		meta[key] = value
+	}
+	if err := validateMeta(meta); err != nil {
+		return err
+	}
+	self = n.members.setSelfMeta(meta)
+	InfoLogger.Println("Metadata is changed to", formatMeta(meta), "at version", self.MetaVersion, ".")
+	// heartbeats of all-to-all mode carry no member list
+	if n.mode == MODE_ALL_TO_ALL && !n.left {
+		payload, err := n.codec.EncodeMembers([]Member{self})
+		if err != nil {
+			return err
+		}
+		n.broadcastMessage(Message{Method: MSG_META, Payload: payload})
+	}
+	return nil
+}
+
+// Meta returns a copy of the metadata of the node
+func (n *Node) Meta() map[string]string {
+	self, _ := n.members.getMemberById(n.id)
+	return copyMeta(self.Meta)
+}
+
+// replace the metadata of the local member and bump its version, return the local member
+func (l *MemberList) setSelfMeta(meta map[string]string) Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	self := l.find(l.selfID)
+	self.Meta = meta
+	self.MetaVersion++
+	l.emit(EVENT_UPDATE, self)
+	return *self
+}
+
+// handle meta message, merge the member list in payload
+func (n *Node) handleMetaMessage(message Message) {
+	memberList, err := n.codec.DecodeMembers(message.Payload)
+	if err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	n.members.mergeGossipMemberList(memberList, n.mode != MODE_ALL_TO_ALL)
+}
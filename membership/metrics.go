@@ -0,0 +1,215 @@
+// This file contains the metrics of a node in the Prometheus text format.
+// Metrics are counted as messages are sent and received, and written on demand
+// by WriteMetrics, so they can be exported with or without the admin API.
+// Labels are written in sorted order, so the output is stable.
+package membership
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reasons of dropped messages
+const (
+	DROP_LOSS    = "loss"    // lost on purpose by MessageLossRate
+	DROP_SEND    = "send"    // failed to send
+	DROP_AUTH    = "auth"    // failed authentication or decryption, or replayed
+	DROP_VERSION = "version" // another codec or protocol version
+	DROP_DECODE  = "decode"  // failed to decode
+)
+
+// kinds of refutations
+const (
+	REFUTE_SELF   = "self"   // the local member refuted a suspicion about itself
+	REFUTE_MEMBER = "member" // a suspected member is found alive
+)
+
+// upper bounds of the buckets of heartbeat jitter in seconds
+var jitterBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// counters of a node, a nil metrics counts nothing
+type metrics struct {
+	mu          sync.Mutex
+	sent        map[string]int // messages sent by method
+	received    map[string]int // messages received by method
+	bytesOut    int
+	bytesIn     int
+	dropped     map[string]int // messages dropped by reason
+	suspicions  int            // members suspected by the local failure detector
+	failures    int            // members confirmed failed
+	refutations map[string]int // suspicions refuted by kind
+
+	// heartbeat jitter, the difference between the period and the time between heartbeats
+	lastHeartbeat time.Time
+	jitterCounts  []int // by buckets, the last one is +Inf
+	jitterSum     float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		sent:         make(map[string]int),
+		received:     make(map[string]int),
+		dropped:      make(map[string]int),
+		refutations:  make(map[string]int),
+		jitterCounts: make([]int, len(jitterBuckets)+1),
+	}
+}
+
+func (m *metrics) countSent(method string, size int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent[method]++
+	m.bytesOut += size
+}
+
+func (m *metrics) countReceived(method string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received[method]++
+}
+
+// count bytes received, before the message is opened or decoded
+func (m *metrics) countBytesIn(size int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytesIn += size
+}
+
+func (m *metrics) countDropped(reason string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[reason]++
+}
+
+func (m *metrics) countSuspicion() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.suspicions++
+}
+
+func (m *metrics) countFailure() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+}
+
+func (m *metrics) countRefutation(kind string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refutations[kind]++
+}
+
+// observe a heartbeat at now, the jitter is measured from the last one
+func (m *metrics) observeHeartbeat(now time.Time, period time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := m.lastHeartbeat
+	m.lastHeartbeat = now
+	if last.IsZero() {
+		return
+	}
+	jitter := math.Abs(now.Sub(last).Seconds() - period.Seconds())
+	bucket := sort.SearchFloat64s(jitterBuckets, jitter)
+	m.jitterCounts[bucket]++
+	m.jitterSum += jitter
+}
+
+// restart measuring jitter, used when heartbeats pause or the period changes
+func (m *metrics) resetHeartbeat() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastHeartbeat = time.Time{}
+}
+
+// WriteMetrics writes the metrics of the node in the Prometheus text format
+func (n *Node) WriteMetrics(w io.Writer) error {
+	statuses := map[string]int{STAT_RUNNING: 0, STAT_SUSPECT: 0, STAT_FAILED: 0, STAT_LEFT: 0}
+	for _, member := range n.members.Snapshot() {
+		statuses[member.Status]++
+	}
+	score := n.health.get()
+	m := n.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := bufio.NewWriter(w)
+	writeMetricHeader(out, "membership_messages_sent_total", "counter", "Messages sent by method.")
+	writeLabeled(out, "membership_messages_sent_total", "method", m.sent)
+	writeMetricHeader(out, "membership_messages_received_total", "counter", "Messages received by method.")
+	writeLabeled(out, "membership_messages_received_total", "method", m.received)
+	writeMetricHeader(out, "membership_bytes_sent_total", "counter", "Bytes sent, over UDP and TCP.")
+	fmt.Fprintf(out, "membership_bytes_sent_total %d\n", m.bytesOut)
+	writeMetricHeader(out, "membership_bytes_received_total", "counter", "Bytes received, over UDP and TCP.")
+	fmt.Fprintf(out, "membership_bytes_received_total %d\n", m.bytesIn)
+	writeMetricHeader(out, "membership_messages_dropped_total", "counter", "Messages dropped by reason.")
+	writeLabeled(out, "membership_messages_dropped_total", "reason", m.dropped)
+	writeMetricHeader(out, "membership_members", "gauge", "Members by status.")
+	writeLabeled(out, "membership_members", "status", statuses)
+	writeMetricHeader(out, "membership_suspicions_total", "counter", "Members suspected by the local failure detector.")
+	fmt.Fprintf(out, "membership_suspicions_total %d\n", m.suspicions)
+	writeMetricHeader(out, "membership_failures_total", "counter", "Members confirmed failed.")
+	fmt.Fprintf(out, "membership_failures_total %d\n", m.failures)
+	writeMetricHeader(out, "membership_refutations_total", "counter", "Suspicions refuted, by the local member itself or by a suspected member found alive.")
+	writeLabeled(out, "membership_refutations_total", "kind", m.refutations)
+	writeMetricHeader(out, "membership_health_score", "gauge", "Local health score, timeouts are scaled by the score plus one.")
+	fmt.Fprintf(out, "membership_health_score %d\n", score)
+	writeMetricHeader(out, "membership_heartbeat_jitter_seconds", "histogram", "Difference between the heartbeat period and the time between heartbeats.")
+	count := 0
+	for i, bound := range jitterBuckets {
+		count += m.jitterCounts[i]
+		fmt.Fprintf(out, "membership_heartbeat_jitter_seconds_bucket{le=\"%g\"} %d\n", bound, count)
+	}
+	count += m.jitterCounts[len(jitterBuckets)]
+	fmt.Fprintf(out, "membership_heartbeat_jitter_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(out, "membership_heartbeat_jitter_seconds_sum %g\n", m.jitterSum)
+	fmt.Fprintf(out, "membership_heartbeat_jitter_seconds_count %d\n", count)
+	return out.Flush()
+}
+
+func writeMetricHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// write a sample of every label value, sorted by the value
+func writeLabeled(w io.Writer, name string, label string, values map[string]int) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, values[key])
+	}
+}
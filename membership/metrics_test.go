@@ -0,0 +1,63 @@
+package membership
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// the metrics of fixed counters are written as in testdata/metrics.golden
+func TestWriteMetrics(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	n := NewNode(Config{Addr: "self:2333", Clock: clock})
+	n.members.heartbeatFromMember("running", "running:2333", false)
+	n.members.heartbeatFromMember("suspect", "suspect:2333", false)
+	n.members.heartbeatFromMember("failed", "failed:2333", false)
+	// the member list counts suspicions and failures
+	n.members.suspectMember("suspect")
+	n.members.suspectMember("failed")
+	n.members.failMember("failed")
+	n.health.apply(2)
+
+	m := n.metrics
+	for i := 0; i < 3; i++ {
+		m.countSent(MSG_PING, 100)
+	}
+	m.countSent(MSG_JOIN, 50)
+	m.countReceived(MSG_PONG)
+	m.countReceived(MSG_PONG)
+	m.countBytesIn(200)
+	m.countDropped(DROP_LOSS)
+	m.countDropped(DROP_AUTH)
+	m.countDropped(DROP_AUTH)
+	m.countRefutation(REFUTE_SELF)
+	// jitters of 0, 0.002 and 2 seconds for a period of 1 second
+	period := time.Second
+	for _, interval := range []time.Duration{0, period, period + 2*time.Millisecond, period + 2*time.Second} {
+		clock.Advance(interval)
+		m.observeHeartbeat(clock.Now(), period)
+	}
+
+	var out bytes.Buffer
+	if err := n.WriteMetrics(&out); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("metrics differ from %s, run with -update to rewrite it:\n%s", golden, out.Bytes())
+	}
+}
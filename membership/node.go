@@ -0,0 +1,296 @@
+// This file contains the Node type, which runs a membership daemon.
+// Several nodes can run in the same process, each with its own state.
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Config of a node
+type Config struct {
+	Addr            string  // local address the node listens on, host:port
+	Mode            string  // heartbeat mode to start in, all-to-all by default
+	VMMode          bool    // whether run in vm, join arguments are pairs of vm number and port
+	MessageLossRate float64 // rate of simulated message loss
+
+	// Deprecated: Introducer has no effect, any running member is a seed,
+	// and every node can join through the others.
+	Introducer bool
+
+	// time a member stays suspected before it is confirmed failed, SuspicionSeconds by default
+	SuspicionTimeout time.Duration
+	// protocol parameters which can be changed while running, zero fields take the defaults
+	Params Params
+	// decides when a member is suspected, a timeout detector by default
+	FailureDetector FailureDetector
+	// serializes messages on the wire, a binary codec by default
+	Codec Codec
+	// cluster keys to sign and verify messages, messages are not signed if nil
+	Keyring *Keyring
+	// whether messages are encrypted with the keyring as well
+	Encrypt bool
+	// metadata of the node, bounded by MaxMetaEntries and MaxMetaSize
+	Meta map[string]string
+	// carries the datagrams, a UDP socket on Addr by default.
+	// Full state sync over TCP is only used with the default transport.
+	Transport Transport
+	// seeds contacted in background when no member listens on them, to heal partitions.
+	// The seeds given to Join are added.
+	Seeds []string
+	// address of the HTTP admin API, host:port, disabled if empty
+	AdminAddr string
+	// tells the time and runs the timers of the node, the system clock by default
+	Clock Clock
+}
+
+// Node is a single member of the group
+type Node struct {
+	config    Config
+	id        string      // unique id of this node
+	addr      string      // local address
+	mode      string      // heartbeat mode
+	modeEpoch int         // epoch of the mode, bumped by every switch
+	params    Params      // protocol parameters
+	left      bool        // whether this node has left the group
+	joined    bool        // whether the full member list is received from a seed
+	members   *MemberList // list storing all info about members
+	detector  FailureDetector
+	codec     Codec
+	clock     Clock
+	auth      *authenticator // nil if messages are not signed
+
+	// swim related
+	probe      *swimProbe               // the probe of current protocol period
+	probeOrder []string                 // ids of members to be probed in following periods
+	pingReqs   map[string][]pingRequest // pending indirect probes by target id
+
+	// all-to-all related
+	pendingPongs  map[string]bool // ids of running members pinged in this round and not acked yet, nil if no round
+	pingedMembers int             // number of running members pinged in this round
+
+	// params related
+	paramsEpoch  int    // epoch of the last spread of parameters
+	paramsOrigin string // id of the member started the last spread
+
+	// join related
+	ctx        context.Context          // context of the running daemon
+	cancelJoin context.CancelFunc       // stops the pending join, nil if not joining
+	seeds      []string                 // addresses of seeds, contacted to heal partitions
+	joinPages  map[string]*joinAckPages // pages of join acks received by seed id, nil if not joining
+	joinAcks   int                      // number of join acks sent as a seed
+
+	// leave related
+	leaveAcks  map[string]bool // members acked the leave by id, nil if not leaving
+	leaveAcked chan struct{}   // signaled when a member acks the leave
+
+	// for statistics and experiment
+	bandwidthUsage int // in bytes
+	metrics        *metrics
+	health         *health // local health, scales the timeouts
+
+	mu            sync.Mutex       // guards all the state above
+	transport     Transport        // for both sending and receiving
+	listener      *net.TCPListener // for full state sync
+	adminListener net.Listener     // for the admin API, nil if disabled
+	messages      chan Message
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+// create a new node from the config, the node is not started
+func NewNode(config Config) *Node {
+	n := &Node{
+		config:   config,
+		addr:     config.Addr,
+		mode:     config.Mode,
+		pingReqs: make(map[string][]pingRequest),
+		messages: make(chan Message, 10),
+		metrics:  newMetrics(),
+		health:   &health{},
+		// signaled without blocking, so one slot is enough
+		leaveAcked: make(chan struct{}, 1),
+	}
+	if n.mode == "" {
+		n.mode = MODE_ALL_TO_ALL
+	}
+	n.params = config.Params.withDefaults()
+	n.addSeeds(config.Seeds...)
+	if n.config.SuspicionTimeout <= 0 {
+		n.config.SuspicionTimeout = SuspicionSeconds * time.Second
+	}
+	n.detector = config.FailureDetector
+	if n.detector == nil {
+		n.detector = NewTimeoutDetector()
+	}
+	n.codec = config.Codec
+	if n.codec == nil {
+		n.codec = BinaryCodec{}
+	}
+	n.clock = config.Clock
+	if n.clock == nil {
+		n.clock = NewRealClock()
+	}
+	// initialize unique id and membership list
+	n.id = generateUniqueId(n.addr, n.clock.Now())
+	n.initializeMemberInfo()
+	return n
+}
+
+// ID returns the unique id of the node
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Addr returns the address the node listens on
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// Start the daemon in background. It stops when ctx is done or Close is called.
+func (n *Node) Start(ctx context.Context) error {
+	if n.transport != nil {
+		return errors.New("node already started")
+	}
+	if !isValidMode(n.mode) {
+		return fmt.Errorf("unknown heartbeat mode: %s", n.mode)
+	}
+	if err := validateMeta(n.config.Meta); err != nil {
+		return err
+	}
+	if err := n.params.validate(); err != nil {
+		return err
+	}
+	if n.config.Keyring != nil {
+		auth, err := newAuthenticator(n.config.Keyring, n.config.Encrypt, n.clock)
+		if err != nil {
+			return fmt.Errorf("invalid cluster key: %v", err)
+		}
+		n.auth = auth
+	} else if n.config.Encrypt {
+		return errors.New("encryption needs a cluster key")
+	}
+	if n.config.Transport != nil {
+		n.transport = n.config.Transport
+	} else {
+		transport, err := listenUDP(n.addr)
+		if err != nil {
+			return err
+		}
+		if err = n.listenPushPull(); err != nil {
+			transport.Close()
+			return err
+		}
+		n.transport = transport
+	}
+	if n.config.AdminAddr != "" {
+		if err := n.listenAdmin(); err != nil {
+			n.transport.Close()
+			n.transport = nil
+			if n.listener != nil {
+				n.listener.Close()
+				n.listener = nil
+			}
+			return err
+		}
+	}
+	// output server info
+	InfoLogger.Println("Server Started at:", n.addr,
+		", Unique ID:", n.id,
+		", Mode:", n.mode,
+		", Codec:", n.codec.Name(),
+		", Signed:", n.auth != nil,
+		", Encrypted:", n.config.Encrypt)
+
+	ctx, n.cancel = context.WithCancel(ctx)
+	n.ctx = ctx
+	n.wg.Add(4)
+	go n.readMessage(ctx) // read messages from the transport
+	go n.runHeartBeat(ctx)
+	go n.runHeal(ctx) // contact failed members and seeds
+	go n.run(ctx)
+	if n.listener != nil {
+		n.wg.Add(2)
+		go n.servePushPull(ctx) // sync full state over TCP
+		go n.runPushPull(ctx)
+	}
+	if n.adminListener != nil {
+		n.wg.Add(1)
+		go n.serveAdmin(ctx)
+		InfoLogger.Println("Admin API listening at:", n.adminListener.Addr())
+	}
+	return nil
+}
+
+// Close stops the daemon and releases the socket
+func (n *Node) Close() error {
+	if n.cancel == nil {
+		return nil
+	}
+	n.cancel()
+	n.wg.Wait()
+	n.members.Close()
+	return nil
+}
+
+// Members returns a copy of the membership list
+func (n *Node) Members() []Member {
+	return n.members.Snapshot()
+}
+
+// Subscribe returns a channel of membership changes, closed when the node is closed.
+// Events of the same member are delivered in order, a slow reader does not block the node.
+func (n *Node) Subscribe() <-chan MemberEvent {
+	return n.members.Subscribe()
+}
+
+// Mode returns the current heartbeat mode of the node
+func (n *Node) Mode() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.mode
+}
+
+// BandwidthUsage returns the bytes sent by the node
+func (n *Node) BandwidthUsage() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.bandwidthUsage
+}
+
+// continuously, handle messages and check failures
+func (n *Node) run(ctx context.Context) {
+	defer n.wg.Done()
+	// close connect when the daemon stops
+	defer func() {
+		n.mu.Lock()
+		n.transport.Close()
+		n.mu.Unlock()
+	}()
+	for {
+		n.mu.Lock()
+		n.checkFailure()
+		if n.mode == MODE_SWIM {
+			n.checkProbe()
+		}
+		n.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-n.messages:
+			n.mu.Lock()
+			n.handleMessage(message)
+			n.mu.Unlock()
+		case <-n.clock.After(SleepPeriod * time.Millisecond):
+		}
+	}
+}
+
+// print the Bandwidth Usage
+func (n *Node) printBandwidthUsage() {
+	InfoLogger.Println("Bandwidth Used:", n.bandwidthUsage, "Bytes.")
+}
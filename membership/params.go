@@ -0,0 +1,208 @@
+// This file contains the protocol parameters which can be tuned while the node is running.
+// Parameters start from the config of a node, and are changed by the set command or the admin API.
+// A change can be spread to all members, so that the group runs with the same timing.
+// A spread carries all parameters with an epoch, and the parameters of the newest epoch win.
+// Members which take a newer spread pass it on once, so a lost datagram is covered by the others.
+package membership
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// names of the parameters
+const (
+	PARAM_GOSSIP_TIMEOUT     = "gossip-timeout"
+	PARAM_ALL_TO_ALL_TIMEOUT = "all-to-all-timeout"
+	PARAM_CLEANUP            = "cleanup"
+	PARAM_HEARTBEAT_PERIOD   = "heartbeat-period"
+	PARAM_GOSSIP_RATE        = "gossip-rate"
+	PARAM_MAX_BUFFER_SIZE    = "max-buffer-size"
+)
+
+// max size of a UDP datagram, the read buffer fits any
+const maxDatagramSize = 65535
+
+// Params are the protocol parameters of a node, zero fields take the defaults in global.go
+type Params struct {
+	GossipTimeout   time.Duration // no heartbeat for this long suspects a member, in gossip and swim mode
+	AllToAllTimeout time.Duration // no heartbeat for this long suspects a member, in all-to-all mode
+	CleanUp         time.Duration // failed and left members are removed after this long
+	HeartbeatPeriod time.Duration // period of heartbeats and swim probes
+	GossipRate      int           // how many members a gossip is sent to
+	MaxBufferSize   int           // max size of a message in bytes
+}
+
+// payload of a params message
+type paramsPayload struct {
+	Epoch  int    // bumped by every spread
+	Origin string // id of the member started the spread, breaks ties of the same epoch
+	Params Params
+}
+
+// DefaultParams returns the parameters in global.go
+func DefaultParams() Params {
+	return Params{
+		GossipTimeout:   GossipTimeOutSeconds * time.Second,
+		AllToAllTimeout: AllToAllTimeOutSeconds * time.Second,
+		CleanUp:         CleanUpSeconds * time.Second,
+		HeartbeatPeriod: HeartbeatPeriod * time.Millisecond,
+		GossipRate:      GossipRate,
+		MaxBufferSize:   MaxBufferSize,
+	}
+}
+
+// fill zero fields with the defaults
+func (p Params) withDefaults() Params {
+	defaults := DefaultParams()
+	if p.GossipTimeout == 0 {
+		p.GossipTimeout = defaults.GossipTimeout
+	}
+	if p.AllToAllTimeout == 0 {
+		p.AllToAllTimeout = defaults.AllToAllTimeout
+	}
+	if p.CleanUp == 0 {
+		p.CleanUp = defaults.CleanUp
+	}
+	if p.HeartbeatPeriod == 0 {
+		p.HeartbeatPeriod = defaults.HeartbeatPeriod
+	}
+	if p.GossipRate == 0 {
+		p.GossipRate = defaults.GossipRate
+	}
+	if p.MaxBufferSize == 0 {
+		p.MaxBufferSize = defaults.MaxBufferSize
+	}
+	return p
+}
+
+// check the bounds of parameters
+func (p Params) validate() error {
+	if p.GossipTimeout <= 0 || p.AllToAllTimeout <= 0 || p.CleanUp <= 0 || p.HeartbeatPeriod <= 0 {
+		return errors.New("timeouts and periods must be positive")
+	}
+	if p.GossipRate <= 0 {
+		return fmt.Errorf("invalid gossip rate: %d", p.GossipRate)
+	}
+	if p.MaxBufferSize < GossipBudget || p.MaxBufferSize > maxDatagramSize {
+		return fmt.Errorf("max buffer size must be between %d and %d bytes", GossipBudget, maxDatagramSize)
+	}
+	return nil
+}
+
+// Set changes a parameter by its name, durations are like 500ms or 10s
+func (p *Params) Set(name string, value string) error {
+	changed := *p
+	var err error
+	switch name {
+	case PARAM_GOSSIP_TIMEOUT:
+		changed.GossipTimeout, err = time.ParseDuration(value)
+	case PARAM_ALL_TO_ALL_TIMEOUT:
+		changed.AllToAllTimeout, err = time.ParseDuration(value)
+	case PARAM_CLEANUP:
+		changed.CleanUp, err = time.ParseDuration(value)
+	case PARAM_HEARTBEAT_PERIOD:
+		changed.HeartbeatPeriod, err = time.ParseDuration(value)
+	case PARAM_GOSSIP_RATE:
+		changed.GossipRate, err = strconv.Atoi(value)
+	case PARAM_MAX_BUFFER_SIZE:
+		changed.MaxBufferSize, err = strconv.Atoi(value)
+	default:
+		return fmt.Errorf("unknown parameter: %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value of %s: %v", name, err)
+	}
+	if err := changed.validate(); err != nil {
+		return err
+	}
+	*p = changed
+	return nil
+}
+
+// Values returns the parameters formatted by their names
+func (p Params) Values() map[string]string {
+	return map[string]string{
+		PARAM_GOSSIP_TIMEOUT:     p.GossipTimeout.String(),
+		PARAM_ALL_TO_ALL_TIMEOUT: p.AllToAllTimeout.String(),
+		PARAM_CLEANUP:            p.CleanUp.String(),
+		PARAM_HEARTBEAT_PERIOD:   p.HeartbeatPeriod.String(),
+		PARAM_GOSSIP_RATE:        strconv.Itoa(p.GossipRate),
+		PARAM_MAX_BUFFER_SIZE:    strconv.Itoa(p.MaxBufferSize),
+	}
+}
+
+// print the parameters sorted by name
+func (p Params) print() {
+	values := p.Values()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  - %s: %s\n", name, values[name])
+	}
+}
+
+// Params returns the current parameters of the node
+func (n *Node) Params() Params {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.params
+}
+
+// SetParam changes a parameter of the node, and spreads all parameters to every member if spread is set
+func (n *Node) SetParam(name string, value string, spread bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	params := n.params
+	if err := params.Set(name, value); err != nil {
+		return err
+	}
+	n.params = params
+	InfoLogger.Println("Parameter", name, "is set to", value, ".")
+	if spread && !n.left {
+		n.paramsEpoch++
+		n.paramsOrigin = n.id
+		n.broadcastParams()
+	}
+	return nil
+}
+
+// send the parameters of the current epoch to every member
+func (n *Node) broadcastParams() {
+	payload, err := json.Marshal(paramsPayload{Epoch: n.paramsEpoch, Origin: n.paramsOrigin, Params: n.params})
+	if err != nil {
+		ErrorLogger.Println("Encode error:", err)
+		return
+	}
+	n.broadcastMessage(Message{Method: MSG_PARAMS, Payload: payload})
+}
+
+// handle params message, take the parameters of a newer spread and pass it on
+func (n *Node) handleParamsMessage(message Message) {
+	var spread paramsPayload
+	if err := json.Unmarshal(message.Payload, &spread); err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	if spread.Epoch < n.paramsEpoch || (spread.Epoch == n.paramsEpoch && spread.Origin <= n.paramsOrigin) {
+		return
+	}
+	if err := spread.Params.validate(); err != nil {
+		WarnLogger.Println("Dropped parameters from", message.SenderID, ":", err)
+		return
+	}
+	n.params = spread.Params
+	n.paramsEpoch = spread.Epoch
+	n.paramsOrigin = spread.Origin
+	InfoLogger.Println("Parameters are changed by", spread.Origin, "at epoch", spread.Epoch, ".")
+	if !n.left {
+		n.broadcastParams()
+	}
+}
@@ -0,0 +1,196 @@
+// This file contains the full state sync over TCP.
+// Gossip only carries the part of member list that fits into a datagram,
+// so periodically, and when joining, a node pushes its full member list
+// to another member over TCP and pulls the full list of that member back.
+// Each message on the connection is prefixed by its length in 4 bytes.
+package membership
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// listen for full state sync on the same port as UDP
+func (n *Node) listenPushPull() error {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", n.addr)
+	if err != nil {
+		return fmt.Errorf("can't resolve address: %v", err)
+	}
+	listener, err := net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start push/pull server: %v", err)
+	}
+	n.listener = listener
+	return nil
+}
+
+// accept full state sync from other members
+func (n *Node) servePushPull(ctx context.Context) {
+	defer n.wg.Done()
+	go func() {
+		<-ctx.Done()
+		n.listener.Close()
+	}()
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				ErrorLogger.Println("failed to accept TCP:", err)
+			}
+			return
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			defer conn.Close()
+			if err := n.handlePushPull(conn); err != nil {
+				WarnLogger.Println("Push/pull from", conn.RemoteAddr(), "failed:", err)
+			}
+		}()
+	}
+}
+
+// merge the pushed member list, and reply with the local one
+func (n *Node) handlePushPull(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(PushPullTimeout * time.Second))
+	remoteState, remoteMembers, err := n.readFullState(conn)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	if !n.left {
+		n.observeMode(remoteState)
+	}
+	n.members.mergeGossipMemberList(remoteMembers, n.mode != MODE_ALL_TO_ALL)
+	state, err := n.encodeFullState()
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return n.writeFullState(conn, state)
+}
+
+// periodically sync full state with a random member
+func (n *Node) runPushPull(ctx context.Context) {
+	defer n.wg.Done()
+	ticker := n.clock.NewTicker(PushPullPeriod * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		n.mu.Lock()
+		var members []Member
+		if !n.left {
+			members = n.getRandomMembers(1)
+		}
+		n.mu.Unlock()
+		if len(members) == 0 {
+			continue
+		}
+		if _, err := n.pushPull(members[0].Addr); err != nil {
+			WarnLogger.Println("Push/pull with", members[0].Addr, "failed:", err)
+		}
+	}
+}
+
+// push the full member list to a remote member and merge the list it replies,
+// return the full state message of the remote member
+func (n *Node) pushPull(remoteAddrStr string) (Message, error) {
+	n.mu.Lock()
+	state, err := n.encodeFullState()
+	n.mu.Unlock()
+	if err != nil {
+		return Message{}, err
+	}
+	conn, err := net.DialTimeout("tcp", remoteAddrStr, PushPullTimeout*time.Second)
+	if err != nil {
+		return Message{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(PushPullTimeout * time.Second))
+	if err = n.writeFullState(conn, state); err != nil {
+		return Message{}, err
+	}
+	remoteState, remoteMembers, err := n.readFullState(conn)
+	if err != nil {
+		return Message{}, err
+	}
+	n.mu.Lock()
+	if !n.left {
+		n.observeMode(remoteState)
+	}
+	n.members.mergeGossipMemberList(remoteMembers, n.mode != MODE_ALL_TO_ALL)
+	n.mu.Unlock()
+	DebugLogger.Println("Synced full state with", remoteAddrStr)
+	return remoteState, nil
+}
+
+// serialize the full member list as a push/pull message
+func (n *Node) encodeFullState() ([]byte, error) {
+	memberListBytes, err := n.codec.EncodeMembers(n.members.Snapshot())
+	if err != nil {
+		return nil, err
+	}
+	return n.sealMessage(n.stampMessage(Message{
+		Method:  MSG_PUSH_PULL,
+		Payload: memberListBytes,
+	}))
+}
+
+func (n *Node) writeFullState(conn net.Conn, state []byte) error {
+	frame := make([]byte, 4+len(state))
+	binary.BigEndian.PutUint32(frame, uint32(len(state)))
+	copy(frame[4:], state)
+	if _, err := conn.Write(frame); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.bandwidthUsage += len(frame)
+	n.mu.Unlock()
+	n.metrics.countSent(MSG_PUSH_PULL, len(frame))
+	return nil
+}
+
+// read a full state, return the message and the member list in its payload
+func (n *Node) readFullState(conn net.Conn) (Message, []Member, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return Message{}, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxPushPullSize {
+		return Message{}, nil, fmt.Errorf("full state of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return Message{}, nil, err
+	}
+	n.metrics.countBytesIn(len(header) + len(data))
+	data, err := n.openMessage(data)
+	if err != nil {
+		n.metrics.countDropped(DROP_AUTH)
+		return Message{}, nil, err
+	}
+	message, err := n.codec.DecodeMessage(data)
+	if errors.Is(err, ErrVersionMismatch) {
+		n.metrics.countDropped(DROP_VERSION)
+		return Message{}, nil, err
+	} else if err != nil {
+		n.metrics.countDropped(DROP_DECODE)
+		return Message{}, nil, err
+	}
+	n.metrics.countReceived(message.Method)
+	if message.Method != MSG_PUSH_PULL {
+		return Message{}, nil, errors.New("unexpected message " + message.Method)
+	}
+	members, err := n.codec.DecodeMembers(message.Payload)
+	return message, members, err
+}
@@ -0,0 +1,202 @@
+// This file contains an in-memory network to simulate a group in a single process.
+// Nodes are given endpoints of the same SimNetwork as their Transport.
+// Datagrams are delivered after a latency measured by the clock of the network,
+// and can be lost, reordered, or blocked by a partition.
+// With a FakeClock, latencies and timeouts are measured in virtual time, and a fixed seed fixes the randomness.
+// Runs are still not exactly the same, as nodes run in their own goroutines
+// and datagrams take their random losses and latencies in the order they are sent.
+package membership
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// max datagrams waiting to be read by an endpoint, more are dropped like a full socket buffer
+const simQueueSize = 1024
+
+// ErrTransportClosed is returned when reading from or writing to a closed transport
+var ErrTransportClosed = errors.New("transport is closed")
+
+// SimNetwork is an in-memory network of endpoints.
+type SimNetwork struct {
+	clock Clock
+
+	mu          sync.Mutex
+	random      *rand.Rand
+	latency     time.Duration // min latency of a datagram
+	jitter      time.Duration // max latency added randomly
+	lossRate    float64       // rate of datagrams lost
+	reorderRate float64       // rate of datagrams delayed by another latency, so that they are reordered
+	groups      map[string]int
+	endpoints   map[string]*simEndpoint
+	stats       SimStats
+}
+
+// SimStats counts the datagrams of a simulated network
+type SimStats struct {
+	Sent        int
+	Delivered   int
+	Lost        int // lost randomly
+	Partitioned int // blocked by a partition
+	Unreachable int // sent to an unknown or closed endpoint, or to a full queue
+}
+
+// a datagram in the network
+type simPacket struct {
+	data []byte
+	from string
+}
+
+// an endpoint of the network, bound to an address
+type simEndpoint struct {
+	network *SimNetwork
+	addr    string
+	queue   chan simPacket
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// create a network measuring latency by the clock, seed makes the randomness reproducible
+func NewSimNetwork(clock Clock, seed int64) *SimNetwork {
+	if clock == nil {
+		clock = NewRealClock()
+	}
+	return &SimNetwork{
+		clock:     clock,
+		random:    rand.New(rand.NewSource(seed)),
+		groups:    make(map[string]int),
+		endpoints: make(map[string]*simEndpoint),
+	}
+}
+
+// Endpoint returns a transport bound to the address, it replaces a closed one of the same address
+func (s *SimNetwork) Endpoint(addr string) Transport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint := &simEndpoint{
+		network: s,
+		addr:    addr,
+		queue:   make(chan simPacket, simQueueSize),
+		closed:  make(chan struct{}),
+	}
+	s.endpoints[addr] = endpoint
+	return endpoint
+}
+
+// SetLatency sets the latency of datagrams, between latency and latency + jitter
+func (s *SimNetwork) SetLatency(latency time.Duration, jitter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency, s.jitter = latency, jitter
+}
+
+// SetLossRate sets the rate of datagrams lost
+func (s *SimNetwork) SetLossRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lossRate = rate
+}
+
+// SetReorderRate sets the rate of datagrams delayed by another latency
+func (s *SimNetwork) SetReorderRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reorderRate = rate
+}
+
+// Partition splits the network, addresses in different groups can't reach each other.
+// Addresses in no group reach everyone.
+func (s *SimNetwork) Partition(groups ...[]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = make(map[string]int)
+	for index, group := range groups {
+		for _, addr := range group {
+			s.groups[addr] = index
+		}
+	}
+}
+
+// Heal removes all partitions
+func (s *SimNetwork) Heal() {
+	s.Partition()
+}
+
+// Stats returns the counters of datagrams
+func (s *SimNetwork) Stats() SimStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// send a datagram, it is delivered later by the clock
+func (s *SimNetwork) send(from string, to string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Sent++
+	fromGroup, fromGrouped := s.groups[from]
+	toGroup, toGrouped := s.groups[to]
+	if fromGrouped && toGrouped && fromGroup != toGroup {
+		s.stats.Partitioned++
+		return
+	}
+	if s.lossRate > 0 && s.random.Float64() < s.lossRate {
+		s.stats.Lost++
+		return
+	}
+	delay := s.latency
+	if s.jitter > 0 {
+		delay += time.Duration(s.random.Int63n(int64(s.jitter)))
+	}
+	if s.reorderRate > 0 && s.random.Float64() < s.reorderRate {
+		delay += s.latency + s.jitter
+	}
+	packet := simPacket{data: append([]byte(nil), data...), from: from}
+	s.clock.AfterFunc(delay, func() { s.deliver(to, packet) })
+}
+
+// put a datagram into the queue of its endpoint
+func (s *SimNetwork) deliver(to string, packet simPacket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint, ok := s.endpoints[to]
+	if !ok {
+		s.stats.Unreachable++
+		return
+	}
+	select {
+	case <-endpoint.closed:
+		s.stats.Unreachable++
+	case endpoint.queue <- packet:
+		s.stats.Delivered++
+	default:
+		s.stats.Unreachable++
+	}
+}
+
+func (e *simEndpoint) WriteTo(data []byte, addr string) error {
+	select {
+	case <-e.closed:
+		return ErrTransportClosed
+	default:
+	}
+	e.network.send(e.addr, addr, data)
+	return nil
+}
+
+func (e *simEndpoint) ReadFrom(buffer []byte) (int, string, error) {
+	select {
+	case <-e.closed:
+		return 0, "", ErrTransportClosed
+	case packet := <-e.queue:
+		return copy(buffer, packet.data), packet.from, nil
+	}
+}
+
+func (e *simEndpoint) Close() error {
+	e.once.Do(func() { close(e.closed) })
+	return nil
+}
@@ -0,0 +1,218 @@
+package membership
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// logs are only written with -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		InfoLogger.SetOutput(ioutil.Discard)
+		DebugLogger.SetOutput(ioutil.Discard)
+		WarnLogger.SetOutput(ioutil.Discard)
+		ErrorLogger.SetOutput(ioutil.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// virtual time advanced by every step of a simulation, and the real time given to the nodes to catch up
+const (
+	simStep  = 20 * time.Millisecond
+	simYield = 100 * time.Microsecond
+)
+
+// a group of nodes on a simulated network, driven by a fake clock
+type simCluster struct {
+	t       *testing.T
+	clock   *FakeClock
+	network *SimNetwork
+	nodes   []*Node
+}
+
+// start size nodes, config changes the config of each node before it is created
+func newSimCluster(t *testing.T, size int, seed int64, config func(index int, c *Config)) *simCluster {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	c := &simCluster{t: t, clock: clock, network: NewSimNetwork(clock, seed)}
+	c.network.SetLatency(10*time.Millisecond, 5*time.Millisecond)
+	for index := 0; index < size; index++ {
+		addr := simAddr(index)
+		nodeConfig := Config{Addr: addr, Transport: c.network.Endpoint(addr), Clock: clock}
+		if config != nil {
+			config(index, &nodeConfig)
+		}
+		node := NewNode(nodeConfig)
+		if err := node.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { node.Close() })
+		c.nodes = append(c.nodes, node)
+	}
+	return c
+}
+
+func simAddr(index int) string {
+	return fmt.Sprintf("node%d:2333", index)
+}
+
+// all other nodes join through the first one
+func (c *simCluster) joinAll() {
+	for _, node := range c.nodes[1:] {
+		if err := node.Join(simAddr(0)); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// advance the clock by d
+func (c *simCluster) run(d time.Duration) {
+	for end := c.clock.Now().Add(d); c.clock.Now().Before(end); {
+		c.clock.Advance(simStep)
+		time.Sleep(simYield)
+	}
+}
+
+// advance the clock until cond holds, return the virtual time it took, or fail after timeout
+func (c *simCluster) waitFor(what string, timeout time.Duration, cond func() bool) time.Duration {
+	c.t.Helper()
+	start := c.clock.Now()
+	for !cond() {
+		if c.clock.Now().Sub(start) > timeout {
+			c.dump()
+			c.t.Fatalf("%s: not done in %v", what, timeout)
+		}
+		c.clock.Advance(simStep)
+		time.Sleep(simYield)
+	}
+	return c.clock.Now().Sub(start)
+}
+
+// status of a member as seen by the observer, empty if unknown
+func (c *simCluster) status(observer int, member int) string {
+	entry, _ := c.nodes[observer].members.getMemberById(c.nodes[member].ID())
+	return entry.Status
+}
+
+// whether every observer sees every member with the status
+func (c *simCluster) sees(observers []int, members []int, status string) bool {
+	for _, observer := range observers {
+		for _, member := range members {
+			if observer != member && c.status(observer, member) != status {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// whether every node knows exactly all nodes as running
+func (c *simCluster) converged() bool {
+	for index, node := range c.nodes {
+		if node.members.Len() != len(c.nodes) || !c.sees([]int{index}, c.all(), STAT_RUNNING) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexes of all nodes
+func (c *simCluster) all() []int {
+	return indexes(0, len(c.nodes))
+}
+
+// indexes from start to end, end excluded
+func indexes(start int, end int) []int {
+	var result []int
+	for index := start; index < end; index++ {
+		result = append(result, index)
+	}
+	return result
+}
+
+// log the member lists of all nodes
+func (c *simCluster) dump() {
+	for index, node := range c.nodes {
+		for _, member := range node.Members() {
+			c.t.Logf("node%d sees %s at %s: %s, incarnation %d", index, member.ID, member.Addr, member.Status, member.Incarnation)
+		}
+	}
+}
+
+// sum of the suspicions and failures detected by the nodes
+func (c *simCluster) detections(nodes []int) (suspicions int, failures int) {
+	for _, index := range nodes {
+		m := c.nodes[index].metrics
+		m.mu.Lock()
+		suspicions += m.suspicions
+		failures += m.failures
+		m.mu.Unlock()
+	}
+	return suspicions, failures
+}
+
+func TestSimDetection(t *testing.T) {
+	tests := []struct {
+		mode          string
+		size          int
+		lossRate      float64
+		maxConverge   time.Duration // all nodes know each other after the join
+		maxDetection  time.Duration // all nodes see a crashed node failed
+		maxSuspicions float64       // false suspicions per pair of healthy nodes in a minute
+	}{
+		// detection takes the heartbeat timeout and the suspicion timeout, and in gossip mode
+		// the failure spreads in a few rounds, lost datagrams delay the join and the detection.
+		// A join retried three times backs off for 1s, 2s and 4s, so a lossy join may take over 10s
+		{mode: MODE_ALL_TO_ALL, size: 8, maxConverge: 3 * time.Second, maxDetection: 12 * time.Second},
+		{mode: MODE_ALL_TO_ALL, size: 8, lossRate: 0.1, maxConverge: 20 * time.Second, maxDetection: 16 * time.Second, maxSuspicions: 0.05},
+		{mode: MODE_GOSSIP, size: 8, maxConverge: 5 * time.Second, maxDetection: 20 * time.Second},
+		{mode: MODE_GOSSIP, size: 8, lossRate: 0.1, maxConverge: 20 * time.Second, maxDetection: 25 * time.Second, maxSuspicions: 0.05},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(fmt.Sprintf("%s/loss=%v", test.mode, test.lossRate), func(t *testing.T) {
+			t.Parallel()
+			c := newSimCluster(t, test.size, 1, func(index int, config *Config) {
+				config.Mode = test.mode
+			})
+			c.network.SetLossRate(test.lossRate)
+			c.joinAll()
+			converge := c.waitFor("convergence", time.Minute, c.converged)
+			t.Logf("converged in %v", converge)
+			if converge > test.maxConverge {
+				t.Errorf("converged in %v, want at most %v", converge, test.maxConverge)
+			}
+
+			// no healthy node is confirmed failed, and few are suspected
+			c.run(time.Minute)
+			suspicions, failures := c.detections(c.all())
+			if failures != 0 {
+				t.Errorf("%d healthy nodes are confirmed failed", failures)
+			}
+			pairs := float64(test.size * (test.size - 1))
+			if rate := float64(suspicions) / pairs; rate > test.maxSuspicions {
+				t.Errorf("false suspicion rate %.3f per pair in a minute, want at most %.3f", rate, test.maxSuspicions)
+			}
+
+			// a crashed node is confirmed failed by all others
+			crashed := test.size - 1
+			c.nodes[crashed].Close()
+			others := indexes(0, crashed)
+			detection := c.waitFor("detection", time.Minute, func() bool {
+				return c.sees(others, []int{crashed}, STAT_FAILED)
+			})
+			t.Logf("detected in %v, %d false suspicions", detection, suspicions)
+			if detection > test.maxDetection {
+				t.Errorf("detected in %v, want at most %v", detection, test.maxDetection)
+			}
+			if _, failures := c.detections(others); failures == 0 {
+				t.Error("no failure is detected locally")
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// This file includes the SWIM style failure detection.
+// Every protocol period, a node probes one member directly with a ping.
+// If no pong comes back within SwimProbeTimeout, it asks SwimIndirectProbes
+// other members to probe the target with a ping-req, and the target is only
+// suspected if nobody got an ack by the end of the period.
+// Recently changed members are piggybacked on pings and pongs.
+package membership
+
+import (
+	"time"
+)
+
+// a direct probe of the current protocol period
+type swimProbe struct {
+	target   Member
+	start    time.Time
+	acked    bool // whether an ack is received, directly or indirectly
+	indirect bool // whether ping-req has been sent
+	helpers  int  // members asked to probe indirectly
+	periods  int  // protocol periods passed, an unhealthy node probes for more periods, see health.go
+}
+
+// a ping-req received from another member
+type pingRequest struct {
+	requesterAddr string
+	timestamp     time.Time
+}
+
+// SWIM style heartbeat, probe one member each period
+func (n *Node) swimHeartBeat() {
+	n.members.incrementHeartbeat(n.id)
+	// the probe lasts as many periods as the health multiplier, unless it is acked
+	if probe := n.probe; probe != nil && !probe.acked {
+		probe.periods++
+		if probe.periods < n.health.multiplier() {
+			return
+		}
+	}
+	// the probe of previous period ends now
+	n.finishProbe()
+	target := n.nextProbeTarget()
+	if target == nil {
+		return
+	}
+	n.probe = &swimProbe{target: *target, start: n.clock.Now()}
+	n.sendMessage(Message{Method: MSG_PING, Payload: n.gossipPayload(MSG_PING)}, target.Addr)
+}
+
+// end the probe of current period, the target is suspected if no ack is received.
+// An ack lowers the score of local health. A missed ack raises it, unless the target was already suspected,
+// or no other member was asked to probe it, as then the target is more likely down than the local node slow.
+func (n *Node) finishProbe() {
+	probe := n.probe
+	n.probe = nil
+	if probe == nil {
+		return
+	}
+	if probe.acked {
+		n.health.apply(-1)
+		return
+	}
+	if probe.target.Status == STAT_RUNNING && probe.helpers > 0 {
+		n.health.apply(1)
+	}
+	n.members.suspectMember(probe.target.ID)
+}
+
+// pick the next member to probe, in a round-robin way over a shuffled list
+func (n *Node) nextProbeTarget() *Member {
+	for {
+		if len(n.probeOrder) == 0 {
+			// start a new round
+			for _, member := range n.getRandomMembers(n.members.Len()) {
+				n.probeOrder = append(n.probeOrder, member.ID)
+			}
+			if len(n.probeOrder) == 0 {
+				return nil
+			}
+		}
+		id := n.probeOrder[0]
+		n.probeOrder = n.probeOrder[1:]
+		if member, ok := n.members.getMemberById(id); ok && n.isValidRemoteMember(member) {
+			return &member
+		}
+	}
+}
+
+// check the probe of current period, send ping-req if direct probe timed out
+func (n *Node) checkProbe() {
+	// clean up indirect probes which are never answered
+	for targetID, requests := range n.pingReqs {
+		var pending []pingRequest
+		for _, request := range requests {
+			if n.clock.Now().Sub(request.timestamp) < n.params.HeartbeatPeriod {
+				pending = append(pending, request)
+			}
+		}
+		if len(pending) == 0 {
+			delete(n.pingReqs, targetID)
+		} else {
+			n.pingReqs[targetID] = pending
+		}
+	}
+
+	probe := n.probe
+	if probe == nil || probe.acked || probe.indirect {
+		return
+	}
+	if n.clock.Now().Sub(probe.start) < n.health.scale(SwimProbeTimeout*time.Millisecond) {
+		return
+	}
+	probe.indirect = true
+	var helpers []Member
+	for _, member := range n.getRandomMembers(SwimIndirectProbes + 1) {
+		if member.ID != probe.target.ID && len(helpers) < SwimIndirectProbes {
+			helpers = append(helpers, member)
+		}
+	}
+	if len(helpers) == 0 {
+		return
+	}
+	targetBytes, err := n.codec.EncodeMembers([]Member{probe.target})
+	if err != nil {
+		ErrorLogger.Println("Encode error:", err)
+		return
+	}
+	probe.helpers = len(helpers)
+	n.broadcastMessage(Message{Method: MSG_PING_REQ, Payload: targetBytes}, helpers...)
+	DebugLogger.Println("Sent ping-req about", probe.target.ID, "to", len(helpers), "members.")
+}
+
+// handle ping-req message, probe the target on behalf of the sender
+func (n *Node) handlePingReqMessage(message Message) {
+	targets, err := n.codec.DecodeMembers(message.Payload)
+	if err != nil {
+		ErrorLogger.Println("Decode error:", err)
+		return
+	}
+	if len(targets) != 1 || targets[0].ID == n.id {
+		return
+	}
+	target := targets[0]
+	n.pingReqs[target.ID] = append(n.pingReqs[target.ID], pingRequest{
+		requesterAddr: message.SenderAddr,
+		timestamp:     n.clock.Now(),
+	})
+	n.sendMessage(Message{Method: MSG_PING, Payload: n.gossipPayload(MSG_PING)}, target.Addr)
+}
+
+// handle an ack in swim mode, forward it if others asked for it
+func (n *Node) handleSwimAck(message Message) {
+	if probe := n.probe; probe != nil && probe.target.ID == message.SenderID {
+		probe.acked = true
+	}
+	n.members.ackFromMember(message.SenderID, message.SenderAddr)
+	// forward the ack to members who asked for an indirect probe
+	for _, request := range n.pingReqs[message.SenderID] {
+		n.sendMessage(Message{
+			Method:     MSG_PONG,
+			SenderID:   message.SenderID,
+			SenderAddr: message.SenderAddr,
+			Payload:    message.Payload,
+		}, request.requesterAddr)
+	}
+	delete(n.pingReqs, message.SenderID)
+}
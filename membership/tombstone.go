@@ -0,0 +1,88 @@
+// This file contains the rules to merge entries of a member, and the tombstones of dead members.
+// Of two entries of the same member, the one of the newer incarnation wins.
+// Of the same incarnation, the stronger status wins: left, then failed, then suspected, then running.
+// Only the member itself bumps its incarnation, to refute a suspicion or to rejoin,
+// so a dead member is never brought back by an old entry.
+//
+// A failed or left member is removed after the cleanup time, and a tombstone of it is kept,
+// so that a stale entry still gossiped by others does not add it again.
+// Tombstones are kept longer than an entry can take to spread to all members.
+package membership
+
+import (
+	"math"
+	"time"
+)
+
+// a removed or unknown dead member
+type tombstone struct {
+	member    Member    // the last entry of the member
+	timestamp time.Time // when it is buried
+}
+
+// rank of a status of the same incarnation, a higher rank overrides a lower one
+func statusRank(status string) int {
+	switch status {
+	case STAT_SUSPECT:
+		return 1
+	case STAT_FAILED:
+		return 2
+	case STAT_LEFT:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// whether the entry overrides the old entry of the same member
+func overrides(member Member, oldMember Member) bool {
+	if member.Incarnation != oldMember.Incarnation {
+		return member.Incarnation > oldMember.Incarnation
+	}
+	return statusRank(member.Status) > statusRank(oldMember.Status)
+}
+
+// keep a tombstone of a dead member, the caller holds the lock
+func (l *MemberList) bury(member Member) {
+	if old, ok := l.tombstones[member.ID]; ok && !overrides(member, old.member) {
+		return
+	}
+	l.tombstones[member.ID] = tombstone{member: member, timestamp: l.clock.Now()}
+}
+
+// whether the entry is not newer than the tombstone of the member, the caller holds the lock
+func (l *MemberList) buried(member Member) bool {
+	old, ok := l.tombstones[member.ID]
+	return ok && !overrides(member, old.member)
+}
+
+// forget tombstones older than the timeout
+func (l *MemberList) pruneTombstones(timeout time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	for id, tomb := range l.tombstones {
+		if now.Sub(tomb.timestamp) > timeout {
+			delete(l.tombstones, id)
+		}
+	}
+}
+
+// max time for an entry to spread to all members by gossip, the caller holds the lock.
+// A gossip reaches all members in about log(n) rounds, the multiplier covers lost datagrams.
+func (n *Node) propagationTime() time.Duration {
+	size := len(n.members.Snapshot())
+	rounds := PropagationMultiplier * int(math.Ceil(math.Log2(float64(size+1))))
+	return time.Duration(rounds) * n.params.HeartbeatPeriod
+}
+
+// time a tombstone is kept, the caller holds the lock.
+// A stale entry lives until its failure is detected and confirmed, and the failure has spread,
+// by gossip or by the next full state sync.
+func (n *Node) tombstoneTimeout() time.Duration {
+	timeout := n.params.GossipTimeout
+	if n.params.AllToAllTimeout > timeout {
+		timeout = n.params.AllToAllTimeout
+	}
+	return timeout + n.config.SuspicionTimeout + n.propagationTime() + PushPullPeriod*time.Second
+}
@@ -0,0 +1,122 @@
+package membership
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// random entries of a few members as gossiped by different observers.
+// The metadata of a member only gets newer as its incarnation grows, as it does in a real history.
+func randomEntries(random *rand.Rand) []Member {
+	var entries []Member
+	for count := random.Intn(30); len(entries) < count; {
+		id := fmt.Sprintf("member%d", random.Intn(5))
+		incarnation := random.Intn(4)
+		entries = append(entries, Member{
+			ID:               id,
+			Addr:             id + ":2333",
+			Incarnation:      incarnation,
+			Status:           statusCodes[random.Intn(len(statusCodes))],
+			HeartbeatCounter: random.Intn(100),
+			MetaVersion:      10*incarnation + random.Intn(10),
+		})
+	}
+	return entries
+}
+
+// merge the entries in the order, in batches of random size
+func mergeInOrder(random *rand.Rand, list *MemberList, entries []Member, order []int) {
+	for len(order) > 0 {
+		size := 1 + random.Intn(len(order))
+		batch := make([]Member, 0, size)
+		for _, index := range order[:size] {
+			batch = append(batch, entries[index])
+		}
+		list.mergeGossipMemberList(batch, true)
+		order = order[size:]
+	}
+}
+
+// the winning entry of every member, listed or buried.
+// A dead member is the same whether it is listed or only has a tombstone.
+func mergedView(list *MemberList) map[string]string {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	view := make(map[string]string)
+	for _, member := range list.members {
+		if member.ID == list.selfID {
+			continue
+		}
+		if isActive(member) {
+			view[member.ID] = fmt.Sprintf("%s incarnation %d meta %d", member.Status, member.Incarnation, member.MetaVersion)
+		} else {
+			view[member.ID] = fmt.Sprintf("%s incarnation %d", member.Status, member.Incarnation)
+		}
+	}
+	for id, tomb := range list.tombstones {
+		if _, ok := view[id]; ok {
+			view[id] += " and buried"
+			continue
+		}
+		view[id] = fmt.Sprintf("%s incarnation %d", tomb.member.Status, tomb.member.Incarnation)
+	}
+	return view
+}
+
+func newMergeList() *MemberList {
+	self := Member{ID: "self", Addr: "self:2333", Status: STAT_RUNNING}
+	list := NewMemberList(self, NewTimeoutDetector(), NewFakeClock(time.Unix(1000, 0)))
+	events := list.Subscribe()
+	go func() {
+		for range events {
+		}
+	}()
+	return list
+}
+
+// merging the same entries in any order gives the same view,
+// and once dead members are removed, merging the entries again does not bring them back
+func TestMergeOrderIndependent(t *testing.T) {
+	const trials = 300
+	const orders = 5
+	random := rand.New(rand.NewSource(1))
+	for trial := 0; trial < trials; trial++ {
+		entries := randomEntries(random)
+		var want map[string]string
+		for round := 0; round < orders; round++ {
+			list := newMergeList()
+			mergeInOrder(random, list, entries, random.Perm(len(entries)))
+			view := mergedView(list)
+			if want == nil {
+				want = view
+			} else if !equalViews(view, want) {
+				t.Fatalf("trial %d: entries %+v\nmerged into %v, another order into %v", trial, entries, view, want)
+			}
+
+			for _, member := range list.Snapshot() {
+				if !isActive(member) {
+					list.removeMember(member)
+				}
+			}
+			mergeInOrder(random, list, entries, random.Perm(len(entries)))
+			if again := mergedView(list); !equalViews(again, view) {
+				t.Fatalf("trial %d: entries %+v\nmerged into %v, after removing dead members and merging again into %v", trial, entries, view, again)
+			}
+			list.Close()
+		}
+	}
+}
+
+func equalViews(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, entry := range a {
+		if b[id] != entry {
+			return false
+		}
+	}
+	return true
+}
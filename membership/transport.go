@@ -0,0 +1,84 @@
+// This file contains the transport of datagrams.
+// A node sends and receives all its datagrams through a Transport.
+// By default it is a UDP socket, and tests can use a simulated network, see sim.go.
+package membership
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Transport sends and receives datagrams, it must be safe for concurrent use
+type Transport interface {
+	// send a datagram to the address
+	WriteTo(data []byte, addr string) error
+	// block until a datagram arrives, return its size and the address of the sender
+	ReadFrom(buffer []byte) (int, string, error)
+	// unblock ReadFrom and release the transport
+	Close() error
+}
+
+// an address in the cache of resolved addresses
+type resolvedAddr struct {
+	addr      *net.UDPAddr
+	timestamp time.Time
+}
+
+// transport over a single UDP socket, so that the source port is the listening port
+type udpTransport struct {
+	conn *net.UDPConn
+
+	mu        sync.Mutex
+	addrCache map[string]resolvedAddr
+}
+
+// listen on the udp address
+func listenUDP(addrStr string) (*udpTransport, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp", addrStr)
+	if err != nil {
+		return nil, fmt.Errorf("can't resolve address: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", serverAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start server: %v", err)
+	}
+	return &udpTransport{conn: conn, addrCache: make(map[string]resolvedAddr)}, nil
+}
+
+func (t *udpTransport) WriteTo(data []byte, addrStr string) error {
+	addr, err := t.resolve(addrStr)
+	if err != nil {
+		return fmt.Errorf("can't resolve address: %v", err)
+	}
+	_, err = t.conn.WriteToUDP(data, addr)
+	return err
+}
+
+func (t *udpTransport) ReadFrom(buffer []byte) (int, string, error) {
+	cnt, addr, err := t.conn.ReadFromUDP(buffer)
+	if err != nil {
+		return 0, "", err
+	}
+	return cnt, addr.String(), nil
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// resolve an udp address, resolved addresses are cached for AddrCacheSeconds
+func (t *udpTransport) resolve(addrStr string) (*net.UDPAddr, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cached, ok := t.addrCache[addrStr]; ok && time.Since(cached.timestamp) < AddrCacheSeconds*time.Second {
+		return cached.addr, nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", addrStr)
+	if err != nil {
+		return nil, err
+	}
+	t.addrCache[addrStr] = resolvedAddr{addr: addr, timestamp: time.Now()}
+	return addr, nil
+}
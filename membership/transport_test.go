@@ -0,0 +1,67 @@
+package membership
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// members of the simulated group in the benchmarks
+const benchmarkMembers = 100
+
+// listen on benchmarkMembers local UDP sockets, datagrams are left unread and dropped by the kernel
+func listenMembers(b *testing.B) []string {
+	var addrs []string
+	for i := 0; i < benchmarkMembers; i++ {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			b.Skip("can't listen on UDP:", err)
+		}
+		b.Cleanup(func() { conn.Close() })
+		addrs = append(addrs, conn.LocalAddr().String())
+	}
+	return addrs
+}
+
+// send b.N heartbeat rounds to all members, and report messages sent per second
+func benchmarkHeartbeatRounds(b *testing.B, send func(data []byte, addr string) error) {
+	addrs := listenMembers(b)
+	data, _ := BinaryCodec{}.EncodeMessage(Message{Method: MSG_PING, SenderID: "127.0.0.1:2333-1633046400", SenderAddr: "127.0.0.1:2333"})
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for _, addr := range addrs {
+			if err := send(data, addr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*len(addrs))/time.Since(start).Seconds(), "msgs/s")
+}
+
+// before: a socket is dialed and closed for every message, from an ephemeral port
+func BenchmarkTransportDialPerMessage(b *testing.B) {
+	benchmarkHeartbeatRounds(b, func(data []byte, addrStr string) error {
+		addr, err := net.ResolveUDPAddr("udp", addrStr)
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Write(data)
+		return err
+	})
+}
+
+// after: all messages go through the listening socket, with cached addresses
+func BenchmarkTransportSharedSocket(b *testing.B) {
+	transport, err := listenUDP("127.0.0.1:0")
+	if err != nil {
+		b.Skip("can't listen on UDP:", err)
+	}
+	defer transport.Close()
+	benchmarkHeartbeatRounds(b, transport.WriteTo)
+}